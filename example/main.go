@@ -2,25 +2,57 @@ package main
 
 import (
 	"flag"
+	"io/ioutil"
+	"os"
 	"time"
 
 	v1 "example.com/gitexample/pkg/apis/example.com/v1"
 	"example.com/gitexample/pkg/reconciler"
 	"github.com/ibuildthecloud/gitbacked-controller"
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/git"
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
 var (
-	url      = flag.String("url", "", "URL to git repo")
-	branch   = flag.String("branch", "", "Branch to pull from and push to")
-	interval = flag.Duration("interval", 15*time.Second, "how often to poll git")
-	subdir   = flag.String("subdir", "", "subdirectory in git to operate on")
+	url        = flag.String("url", "", "URL to git repo")
+	branch     = flag.String("branch", "", "Branch to pull from and push to")
+	interval   = flag.Duration("interval", 15*time.Second, "how often to poll git")
+	subdir     = flag.String("subdir", "", "subdirectory in git to operate on")
+	sshKey     = flag.String("ssh-key", "", "path to ssh private key used for ssh URLs")
+	knownHosts = flag.String("known-hosts", "", "path to known_hosts file used to verify the ssh server")
 )
 
+func auth() (*git.Auth, error) {
+	auth := &git.Auth{
+		Username: os.Getenv("GIT_USERNAME"),
+		Password: os.Getenv("GIT_TOKEN"),
+	}
+
+	if *sshKey != "" {
+		key, err := ioutil.ReadFile(*sshKey)
+		if err != nil {
+			return nil, err
+		}
+		auth.SSHPrivateKey = key
+	}
+
+	if *knownHosts != "" {
+		hosts, err := ioutil.ReadFile(*knownHosts)
+		if err != nil {
+			return nil, err
+		}
+		auth.SSHKnownHosts = hosts
+	}
+
+	return auth, nil
+}
+
 func main() {
 	flag.Parse()
 	ctx := ctrl.SetupSignalHandler()
@@ -29,10 +61,21 @@ func main() {
 		logrus.Fatal("-url is required")
 	}
 
+	auth, err := auth()
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
 	git, err := gitbacked.New(ctx, *url, gitbacked.Options{
-		Branch:       *branch,
-		SubDirectory: *subdir,
-		Interval:     *interval,
+		Branch:            *branch,
+		SubDirectory:      *subdir,
+		Interval:          *interval,
+		Auth:              auth,
+		GarbageCollection: true,
+		Scopes: map[schema.GroupKind]meta.RESTScopeName{
+			v1.SchemeGroupVersion.WithKind("Replicator").GroupKind(): meta.RESTScopeNameNamespace,
+			v1.SchemeGroupVersion.WithKind("Replicated").GroupKind(): meta.RESTScopeNameNamespace,
+		},
 	})
 	if err != nil {
 		logrus.Fatal(err)
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	v1 "example.com/gitexample/pkg/apis/example.com/v1"
+	"github.com/ibuildthecloud/gitbacked-controller"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -29,6 +30,12 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 		return ctrl.Result{}, err
 	}
 
+	// create all the missing objects in a single commit
+	tx, err := gitbacked.NewTransaction(r.Client)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
 	for i := 0; i < replicator.Count-len(replicated.Items); i++ {
 		newObj := v1.Replicated{
 			ObjectMeta: metav1.ObjectMeta{
@@ -40,10 +47,10 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 			return ctrl.Result{}, err
 		}
 
-		if err := r.Create(ctx, &newObj); err != nil {
+		if err := tx.Create(&newObj); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{}, tx.Commit(ctx)
 }
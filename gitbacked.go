@@ -2,13 +2,18 @@ package gitbacked
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	cache3 "github.com/ibuildthecloud/gitbacked-controller/pkg/cache"
 	client2 "github.com/ibuildthecloud/gitbacked-controller/pkg/client"
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/git"
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/manifest"
 	"github.com/ibuildthecloud/gitbacked-controller/pkg/mapping"
 	"github.com/ibuildthecloud/gitbacked-controller/pkg/store"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -18,10 +23,116 @@ type Options struct {
 	Branch       string
 	SubDirectory string
 	Interval     time.Duration
+	// Backend selects how git operations are performed, "native" (default) runs git
+	// in process and "exec" runs the git binary
+	Backend git.BackendType
+	// Auth is the static credentials used for clone, fetch and push
+	Auth *git.Auth
+	// AuthProvider is used instead of Auth when credentials need to be looked up or
+	// rotated, it is called before every remote operation
+	AuthProvider git.AuthProvider
+	// Author of the commits, if not set user.name and user.email of the git configuration of
+	// the host are used. The native backend falls back to gitbacked-controller
+	// <gitbacked-controller@localhost> if they are not set, the exec backend leaves it to git.
+	Author *git.Signature
+	// Committer of the commits, defaults to Author
+	Committer *git.Signature
+	// CommitMessageTemplate is a text/template used for the message of every commit. The
+	// fields of store.CommitInfo are available: .Operation (create/update/delete/status/apply),
+	// .Group, .Version, .Kind, .Namespace, .Name, .Generation and .FieldManager
+	CommitMessageTemplate string
+	// BatchWindow coalesces writes from concurrent callers that happen within the window
+	// into a single commit and push. Every write still blocks until its commit is pushed.
+	// Zero, the default, commits every write on its own.
+	BatchWindow time.Duration
+	// BatchSize commits a batch as soon as it has this many writes, zero means no limit
+	BatchSize int
+	// PushRetries is how many times a rejected push is retried. Before every retry the
+	// remote branch is fetched and each write is checked against the new remote head,
+	// failing with a Conflict only if its object changed. Defaults to 5, -1 disables.
+	PushRetries int
+	// RevisionHistory is how many revisions are kept for watches to resume from. Watches
+	// from an older resourceVersion fail with 410 Gone and informers relist. Defaults to
+	// 1000, -1 keeps every revision.
+	RevisionHistory int
+	// RevisionHistoryTTL drops revisions older than this, zero disables
+	RevisionHistoryTTL time.Duration
+	// ResourceVersionFile is a local file where the highest resourceVersion is kept, so that
+	// resourceVersions are never handed out twice across restarts. Without it they are
+	// only derived from the number of commits and changes that are not commits, such as the
+	// repository status and managedFields, or a rewrite of the branch can make a restarted
+	// controller reuse them.
+	ResourceVersionFile string
+	// PathTemplate is a text/template for the path of new objects relative to SubDirectory,
+	// rendered with a store.PathInfo, for example "{{.Namespace}}/{{.Resource}}/{{.Name}}.yaml".
+	// Existing objects are always written back to the file they were read from. Defaults to
+	// <group>/<version>/<kind>/<namespace>/<name>.yaml.
+	PathTemplate string
+	// DefaultFormat is the format of new files, manifest.FormatYAML (the default) or
+	// manifest.FormatJSON. It is available to PathTemplate as .Extension.
+	DefaultFormat manifest.Format
+	// PathStrategy is used instead of PathTemplate if set
+	PathStrategy store.PathStrategy
+	// PathStrategies overrides the path of new objects per kind, a key with an empty
+	// version applies to all versions of the kind
+	PathStrategies map[schema.GroupVersionKind]store.PathStrategy
+	// Scopes declares whether the kinds registered in a scheme are meta.RESTScopeNameRoot
+	// (cluster scoped) or meta.RESTScopeNameNamespace. It is needed for kinds that are not
+	// Kubernetes kinds and have no CustomResourceDefinition in git, the mapper does not guess
+	// their scope and using them fails.
+	Scopes map[schema.GroupKind]meta.RESTScopeName
+	// DefaultNamespace is set on namespaced objects that are written or looked up without a
+	// namespace. If empty such requests fail.
+	DefaultNamespace string
+	// PersistMetadata decides per metadata field if it is written to git, overriding
+	// store.DefaultPersistMetadata. By default resourceVersion, generation,
+	// creationTimestamp, managedFields and selfLink are kept in memory only and new objects
+	// get a random uid that is written to git.
+	PersistMetadata map[string]bool
+	// Include limits the files under SubDirectory that are read as manifests to the ones
+	// matching these gitignore style patterns, for example "apps/**/*.yaml"
+	Include []string
+	// Exclude skips the files matching these gitignore style patterns, in addition to the
+	// .gitbackedignore files in git
+	Exclude []string
+	// DuplicatePolicy decides what happens when the same object is in more than one file,
+	// store.DuplicateFirstWins (the default), store.DuplicateReject or store.DuplicateError.
+	// Duplicates are logged and listed in the GitRepositoryStatus.
+	DuplicatePolicy store.DuplicatePolicy
+	// GarbageCollection deletes objects when all of their owners in ownerReferences are gone,
+	// like the Kubernetes garbage collector. The propagation policy of client.DeleteOptions
+	// is honored: background (the default), foreground and orphan.
+	GarbageCollection bool
+	// FieldManager owns the fields of writes that do not set a field manager in their options,
+	// defaults to store.DefaultFieldManager
+	FieldManager string
+	// GitFieldManager owns the fields changed by commits that were not written through the
+	// client, such as edits by humans, defaults to store.DefaultGitFieldManager
+	GitFieldManager string
+}
+
+// WithCommitMessage sets the commit message for writes done with the returned context,
+// overriding CommitMessageTemplate
+func WithCommitMessage(ctx context.Context, message string) context.Context {
+	return store.WithCommitMessage(ctx, message)
+}
+
+// WithFieldManager sets the field manager of writes done with the returned context that do not
+// set one in their options, such as the writes of a transaction
+func WithFieldManager(ctx context.Context, manager string) context.Context {
+	return store.WithFieldManager(ctx, manager)
+}
+
+// WithCommitTrailer adds a "key: value" trailer to the commit message of writes done with
+// the returned context
+func WithCommitTrailer(ctx context.Context, key, value string) context.Context {
+	return store.WithCommitTrailer(ctx, key, value)
 }
 
 type GitStore struct {
-	store *store.Store
+	store            *store.Store
+	mapper           *mapping.Mapper
+	defaultNamespace string
 }
 
 func (g *GitStore) Close() error {
@@ -32,24 +143,115 @@ func (g *GitStore) Close() error {
 }
 
 func (g *GitStore) NewCache(_ *rest.Config, opts cache.Options) (cache.Cache, error) {
-	c := client2.NewClient(opts.Scheme, opts.Mapper, g.store)
+	c := client2.NewClient(opts.Scheme, g.restMapper(opts.Scheme, opts.Mapper), g.store, g.defaultNamespace)
 	return cache3.New(c), nil
 }
 
 func (g *GitStore) NewClient(_ cache.Cache, _ *rest.Config, options client.Options, _ ...client.Object) (client.Client, error) {
-	return client2.NewClient(options.Scheme, options.Mapper, g.store), nil
+	return client2.NewClient(options.Scheme, g.restMapper(options.Scheme, options.Mapper), g.store, g.defaultNamespace), nil
+}
+
+// restMapper registers the kinds of scheme with the mapper of the store and returns it,
+// unless a different mapper was configured
+func (g *GitStore) restMapper(scheme *runtime.Scheme, mapper meta.RESTMapper) meta.RESTMapper {
+	g.mapper.AddScheme(scheme)
+	if mapper == nil {
+		return g.mapper
+	}
+	return mapper
+}
+
+// resource returns the plural resource name of gvk for the path of new objects
+func (g *GitStore) resource(gvk schema.GroupVersionKind) string {
+	mapping, err := g.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return ""
+	}
+	return mapping.Resource.Resource
 }
 
+// NewTransaction starts a transaction on a client created by NewClient. The writes staged
+// in the transaction are committed as a single git commit.
+func NewTransaction(c client.Client) (*client2.Transaction, error) {
+	gitClient, ok := c.(*client2.Client)
+	if !ok {
+		return nil, fmt.Errorf("client %T is not a git backed client", c)
+	}
+	return gitClient.Begin(), nil
+}
+
+// MapperProvider returns a RESTMapper for the kinds of the schemes used with NewClient and
+// NewCache and the CustomResourceDefinitions in git
 func (g *GitStore) MapperProvider(c *rest.Config) (meta.RESTMapper, error) {
-	return &mapping.Mapper{}, nil
+	return g.mapper, nil
 }
 
 func New(ctx context.Context, url string, opts Options) (*GitStore, error) {
 	if opts.Interval == 0 {
 		opts.Interval = 15 * time.Second
 	}
+	if opts.PushRetries == 0 {
+		opts.PushRetries = 5
+	}
+	if opts.RevisionHistory == 0 {
+		opts.RevisionHistory = 1000
+	}
+
+	authProvider := opts.AuthProvider
+	if authProvider == nil && opts.Auth != nil {
+		authProvider = git.StaticAuth(*opts.Auth)
+	}
+
+	pathStrategy := opts.PathStrategy
+	if pathStrategy == nil && opts.PathTemplate != "" {
+		var err error
+		pathStrategy, err = store.PathTemplate(opts.PathTemplate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for gk, scope := range opts.Scopes {
+		if scope != meta.RESTScopeNameRoot && scope != meta.RESTScopeNameNamespace {
+			return nil, fmt.Errorf("invalid scope %q for %s", scope, gk)
+		}
+	}
+
+	g := &GitStore{
+		mapper:           mapping.New(opts.Scopes),
+		defaultNamespace: opts.DefaultNamespace,
+	}
 
-	store, err := store.New(url, opts.Branch, opts.SubDirectory)
+	store, err := store.New(url, store.Options{
+		SubDirectory:          opts.SubDirectory,
+		CommitMessageTemplate: opts.CommitMessageTemplate,
+		BatchWindow:           opts.BatchWindow,
+		BatchSize:             opts.BatchSize,
+		PushRetries:           opts.PushRetries,
+		RevisionHistory:       opts.RevisionHistory,
+		RevisionHistoryTTL:    opts.RevisionHistoryTTL,
+		ResourceVersionFile:   opts.ResourceVersionFile,
+		DefaultFormat:         opts.DefaultFormat,
+		PathStrategy:          pathStrategy,
+		PathStrategies:        opts.PathStrategies,
+		Resource:              g.resource,
+		CRDHandler:            g.mapper.SetCRDs,
+		ObjectType:            g.mapper.ObjectType,
+		PersistMetadata:       opts.PersistMetadata,
+		Include:               opts.Include,
+		Exclude:               opts.Exclude,
+		DuplicatePolicy:       opts.DuplicatePolicy,
+		GarbageCollection:     opts.GarbageCollection,
+		FieldManager:          opts.FieldManager,
+		GitFieldManager:       opts.GitFieldManager,
+		Git: git.Options{
+			Branch:       opts.Branch,
+			Backend:      opts.Backend,
+			AuthProvider: authProvider,
+			Author:       opts.Author,
+			Committer:    opts.Committer,
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -58,7 +260,6 @@ func New(ctx context.Context, url string, opts Options) (*GitStore, error) {
 		return nil, err
 	}
 
-	return &GitStore{
-		store: store,
-	}, nil
+	g.store = store
+	return g, nil
 }
@@ -0,0 +1,116 @@
+package v1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func (in *GitRepositoryStatus) DeepCopyInto(out *GitRepositoryStatus) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *GitRepositoryStatus) DeepCopy() *GitRepositoryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(GitRepositoryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *GitRepositoryStatus) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+func (in *RepositoryStatus) DeepCopyInto(out *RepositoryStatus) {
+	*out = *in
+	in.LastSyncTime.DeepCopyInto(&out.LastSyncTime)
+	if in.Files != nil {
+		out.Files = make([]FileStatus, len(in.Files))
+		for i := range in.Files {
+			in.Files[i].DeepCopyInto(&out.Files[i])
+		}
+	}
+	if in.Duplicates != nil {
+		out.Duplicates = make([]DuplicateObject, len(in.Duplicates))
+		for i := range in.Duplicates {
+			in.Duplicates[i].DeepCopyInto(&out.Duplicates[i])
+		}
+	}
+}
+
+func (in *RepositoryStatus) DeepCopy() *RepositoryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(RepositoryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *DuplicateObject) DeepCopyInto(out *DuplicateObject) {
+	*out = *in
+	if in.Paths != nil {
+		out.Paths = make([]string, len(in.Paths))
+		copy(out.Paths, in.Paths)
+	}
+}
+
+func (in *DuplicateObject) DeepCopy() *DuplicateObject {
+	if in == nil {
+		return nil
+	}
+	out := new(DuplicateObject)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *FileStatus) DeepCopyInto(out *FileStatus) {
+	*out = *in
+	if in.Problems != nil {
+		out.Problems = make([]string, len(in.Problems))
+		copy(out.Problems, in.Problems)
+	}
+}
+
+func (in *FileStatus) DeepCopy() *FileStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(FileStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *GitRepositoryStatusList) DeepCopyInto(out *GitRepositoryStatusList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]GitRepositoryStatus, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *GitRepositoryStatusList) DeepCopy() *GitRepositoryStatusList {
+	if in == nil {
+		return nil
+	}
+	out := new(GitRepositoryStatusList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *GitRepositoryStatusList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+// Package v1 has the kinds the git backed store serves itself, they are not stored in git
+package v1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	SchemeGroupVersion = schema.GroupVersion{Group: "gitbacked.ibuildthecloud.com", Version: "v1"}
+
+	SchemeBuilder = &scheme.Builder{GroupVersion: SchemeGroupVersion}
+
+	// AddToScheme adds the kinds of this package to a scheme so they can be read with typed objects
+	AddToScheme = SchemeBuilder.AddToScheme
+)
+
+func init() {
+	SchemeBuilder.Register(&GitRepositoryStatus{}, &GitRepositoryStatusList{})
+}
@@ -0,0 +1,61 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GitRepositoryStatusName is the name of the only GitRepositoryStatus object
+const GitRepositoryStatusName = "repository"
+
+// GitRepositoryStatus reports the state of the repository backing the store. It is cluster
+// scoped, read only and is not stored in git.
+type GitRepositoryStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status RepositoryStatus `json:"status,omitempty"`
+}
+
+type RepositoryStatus struct {
+	URL    string `json:"url,omitempty"`
+	Branch string `json:"branch,omitempty"`
+	// Commit is the commit the objects were last read from
+	Commit string `json:"commit,omitempty"`
+	// LastSyncTime is when the branch was last fetched successfully. A change of only this
+	// field does not change the resourceVersion and is not sent to watchers.
+	LastSyncTime metav1.Time `json:"lastSyncTime,omitempty"`
+	// LastPullError is the error of the last fetch, empty if it succeeded
+	LastPullError string `json:"lastPullError,omitempty"`
+	// LastPushError is the error of the last push, empty if it succeeded
+	LastPushError string `json:"lastPushError,omitempty"`
+	// LastScanError is why the last fetched commit was not read, the objects are still the
+	// ones of Commit
+	LastScanError string `json:"lastScanError,omitempty"`
+	// Files are the problems found in the files of the commit, the objects of a file with
+	// problems may be missing
+	Files []FileStatus `json:"files,omitempty"`
+	// Duplicates are the objects that are in more than one file or document
+	Duplicates []DuplicateObject `json:"duplicates,omitempty"`
+}
+
+type DuplicateObject struct {
+	Group     string `json:"group,omitempty"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// Paths are the files of every copy, relative to the subdirectory of the store
+	Paths []string `json:"paths"`
+}
+
+type FileStatus struct {
+	// Path is relative to the subdirectory of the store
+	Path     string   `json:"path"`
+	Problems []string `json:"problems"`
+}
+
+type GitRepositoryStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []GitRepositoryStatus `json:"items"`
+}
@@ -48,7 +48,18 @@ func (c *Cache) Get(ctx context.Context, key client.ObjectKey, obj client.Object
 		return &cache.ErrCacheNotStarted{}
 	}
 
-	found, exist, err := informer.GetStore().GetByKey(key.String())
+	key.Namespace, err = c.client.Namespace(gvk, key.Namespace)
+	if err != nil {
+		return err
+	}
+
+	// same as cache.MetaNamespaceKeyFunc, cluster scoped objects are keyed by name only
+	storeKey := key.Name
+	if key.Namespace != "" {
+		storeKey = key.String()
+	}
+
+	found, exist, err := informer.GetStore().GetByKey(storeKey)
 	if err != nil {
 		return err
 	} else if !exist {
@@ -83,13 +94,18 @@ func (c *Cache) List(ctx context.Context, listObj client.ObjectList, opts ...cli
 		return &cache.ErrCacheNotStarted{}
 	}
 
+	namespace, err := c.client.ListNamespace(gvk, listOptions.Namespace)
+	if err != nil {
+		return err
+	}
+
 	retList := &list{}
 	retList.APIVersion, retList.Kind = gvk.ToAPIVersionAndKind()
 	retList.Kind = retList.Kind + "List"
 
 	for _, listObj := range informer.GetStore().List() {
 		obj := listObj.(client.Object)
-		if listOptions.Namespace != "" && obj.GetNamespace() != listOptions.Namespace {
+		if namespace != "" && obj.GetNamespace() != namespace {
 			continue
 		}
 		if listOptions.LabelSelector != nil && !listOptions.LabelSelector.Matches(labels.Set(obj.GetLabels())) {
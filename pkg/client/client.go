@@ -12,22 +12,27 @@ import (
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
 type Client struct {
-	scheme *runtime.Scheme
-	mapper meta.RESTMapper
-	store  *store.Store
+	scheme           *runtime.Scheme
+	mapper           meta.RESTMapper
+	store            *store.Store
+	defaultNamespace string
 }
 
-func NewClient(scheme *runtime.Scheme, mapper meta.RESTMapper, store *store.Store) *Client {
+// NewClient returns a client for store. Namespaced objects without a namespace are put in
+// defaultNamespace, or rejected if it is empty.
+func NewClient(scheme *runtime.Scheme, mapper meta.RESTMapper, store *store.Store, defaultNamespace string) *Client {
 	return &Client{
-		scheme: scheme,
-		mapper: mapper,
-		store:  store,
+		scheme:           scheme,
+		mapper:           mapper,
+		store:            store,
+		defaultNamespace: defaultNamespace,
 	}
 }
 
@@ -60,7 +65,12 @@ func (c *Client) Get(ctx context.Context, key client.ObjectKey, obj client.Objec
 		return err
 	}
 
-	ret := c.store.Get(gvk, key.Namespace, key.Name)
+	namespace, err := c.Namespace(gvk, key.Namespace)
+	if err != nil {
+		return err
+	}
+
+	ret := c.store.Get(gvk, namespace, key.Name)
 	if ret == nil {
 		return errors.NewNotFound(schema.GroupResource{
 			Group:    gvk.Group,
@@ -81,7 +91,11 @@ func (c *Client) List(ctx context.Context, list client.ObjectList, opts ...clien
 	for _, opt := range opts {
 		opt.ApplyToList(&listOpts)
 	}
-	retList := c.store.List(gvk, listOpts.Namespace, listOpts.LabelSelector)
+	namespace, err := c.ListNamespace(gvk, listOpts.Namespace)
+	if err != nil {
+		return err
+	}
+	retList := c.store.List(gvk, namespace, listOpts.LabelSelector)
 	return Convert(list, retList)
 }
 
@@ -91,7 +105,13 @@ func (c *Client) Create(ctx context.Context, obj client.Object, opts ...client.C
 		return err
 	}
 
-	ret, err := c.store.Create(ctx, gvk, obj)
+	if err := c.setNamespace(gvk, obj); err != nil {
+		return err
+	}
+
+	createOptions := client.CreateOptions{}
+	createOptions.ApplyOptions(opts)
+	ret, err := c.store.Create(withFieldManager(ctx, createOptions.FieldManager), gvk, obj)
 	if err != nil {
 		return err
 	}
@@ -104,11 +124,16 @@ func (c *Client) Delete(ctx context.Context, obj client.Object, opts ...client.D
 		return err
 	}
 
+	namespace, err := c.Namespace(gvk, obj.GetNamespace())
+	if err != nil {
+		return err
+	}
+
 	deleteOptions := client.DeleteOptions{}
 	for _, opt := range opts {
 		opt.ApplyToDelete(&deleteOptions)
 	}
-	return c.store.Delete(ctx, gvk, obj.GetNamespace(), obj.GetName(), deleteOptions.Preconditions)
+	return c.store.Delete(ctx, gvk, namespace, obj.GetName(), deleteOptions.Preconditions, deleteOptions.PropagationPolicy)
 }
 
 func (c *Client) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
@@ -117,7 +142,13 @@ func (c *Client) Update(ctx context.Context, obj client.Object, opts ...client.U
 		return err
 	}
 
-	ret, err := c.store.Update(ctx, gvk, obj, true)
+	if err := c.setNamespace(gvk, obj); err != nil {
+		return err
+	}
+
+	updateOptions := client.UpdateOptions{}
+	updateOptions.ApplyOptions(opts)
+	ret, err := c.store.Update(withFieldManager(ctx, updateOptions.FieldManager), gvk, obj, true)
 	if err != nil {
 		return err
 	}
@@ -134,6 +165,17 @@ func (c *Client) patch(ctx context.Context, obj client.Object, patch client.Patc
 		return err
 	}
 
+	if err := c.setNamespace(gvk, obj); err != nil {
+		return err
+	}
+
+	patchOptions := client.PatchOptions{}
+	patchOptions.ApplyOptions(opts)
+	ctx = withFieldManager(ctx, patchOptions.FieldManager)
+	if patch.Type() == types.ApplyPatchType {
+		return c.apply(ctx, gvk, obj, patch, generation, patchOptions)
+	}
+
 	originalObj := c.store.Get(gvk, obj.GetNamespace(), obj.GetName())
 	if originalObj == nil {
 		return errors.NewNotFound(schema.GroupResource{
@@ -147,7 +189,7 @@ func (c *Client) patch(ctx context.Context, obj client.Object, patch client.Patc
 		return err
 	}
 
-	newBytes, err := apply(gvk, c.scheme, originalObj, patchBytes, patch.Type())
+	newBytes, err := apply(gvk, c.patchMeta, originalObj, patchBytes, patch.Type())
 	if err != nil {
 		return err
 	}
@@ -167,8 +209,64 @@ func (c *Client) patch(ctx context.Context, obj client.Object, patch client.Patc
 	return Convert(obj, ret)
 }
 
+// apply merges the fields of the patch as the field manager of the options. Status patches
+// only apply the status.
+func (c *Client) apply(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object, patch client.Patch, generation bool, opts client.PatchOptions) error {
+	if opts.FieldManager == "" {
+		return errors.NewBadRequest("PATCH requests with apply must include fieldManager")
+	}
+
+	patchBytes, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	config := &unstructured.Unstructured{}
+	if err := config.UnmarshalJSON(patchBytes); err != nil {
+		return errors.NewBadRequest(err.Error())
+	}
+	if config.GetName() != obj.GetName() || config.GetNamespace() != obj.GetNamespace() {
+		return errors.NewBadRequest("the name and namespace of the patch must match the object")
+	}
+	if !generation {
+		if c.store.Get(gvk, obj.GetNamespace(), obj.GetName()) == nil {
+			return errors.NewNotFound(schema.GroupResource{
+				Group:    gvk.Group,
+				Resource: gvk.Kind,
+			}, obj.GetName())
+		}
+		config = statusOnly(config)
+	}
+
+	force := opts.Force != nil && *opts.Force
+	ret, err := c.store.Apply(ctx, gvk, config, force)
+	if err != nil {
+		return err
+	}
+	return Convert(obj, ret)
+}
+
+// withFieldManager sets the field manager of a write if the options have one
+func withFieldManager(ctx context.Context, manager string) context.Context {
+	if manager == "" {
+		return ctx
+	}
+	return store.WithFieldManager(ctx, manager)
+}
+
 func (c *Client) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
-	panic("implement me")
+	gvk, err := c.gvk(obj)
+	if err != nil {
+		return err
+	}
+
+	deleteAllOfOptions := client.DeleteAllOfOptions{}
+	deleteAllOfOptions.ApplyOptions(opts)
+	namespace, err := c.ListNamespace(gvk, deleteAllOfOptions.Namespace)
+	if err != nil {
+		return err
+	}
+	return c.store.DeleteAllOf(ctx, gvk, namespace, deleteAllOfOptions.LabelSelector, deleteAllOfOptions.FieldSelector,
+		deleteAllOfOptions.Preconditions, deleteAllOfOptions.PropagationPolicy)
 }
 
 func (c *Client) Watch(gvk schema.GroupVersionKind, emptyObj client.Object, opts metav1.ListOptions) (watch.Interface, error) {
@@ -184,5 +282,5 @@ func (c *Client) Scheme() *runtime.Scheme {
 }
 
 func (c *Client) RESTMapper() meta.RESTMapper {
-	return nil
+	return c.mapper
 }
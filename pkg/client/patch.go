@@ -5,14 +5,14 @@ import (
 	"fmt"
 
 	jsonpatch "github.com/evanphx/json-patch"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-func apply(gvk schema.GroupVersionKind, scheme *runtime.Scheme, obj client.Object, patch []byte, style types.PatchType) ([]byte, error) {
+func apply(gvk schema.GroupVersionKind, patchMeta func(schema.GroupVersionKind) (strategicpatch.LookupPatchMeta, error), obj client.Object, patch []byte, style types.PatchType) ([]byte, error) {
 	original, err := json.Marshal(obj)
 	if err != nil {
 		return nil, err
@@ -24,22 +24,23 @@ func apply(gvk schema.GroupVersionKind, scheme *runtime.Scheme, obj client.Objec
 	case types.MergePatchType:
 		return applyMergePatch(original, patch)
 	case types.StrategicMergePatchType:
-		return applyStrategicMergePatch(gvk, scheme, original, patch)
+		return applyStrategicMergePatch(gvk, patchMeta, original, patch)
 	default:
 		return nil, fmt.Errorf("unsupported patch style: %v", style)
 	}
 }
 
-func applyStrategicMergePatch(gvk schema.GroupVersionKind, scheme *runtime.Scheme, original, patch []byte) ([]byte, error) {
-	versionedObject, err := scheme.New(gvk)
+// applyStrategicMergePatch uses the patch metadata of gvk and fails for kinds without any
+func applyStrategicMergePatch(gvk schema.GroupVersionKind, patchMeta func(schema.GroupVersionKind) (strategicpatch.LookupPatchMeta, error), original, patch []byte) ([]byte, error) {
+	lookup, err := patchMeta(gvk)
 	if err != nil {
 		return nil, err
 	}
-
-	lookup, err := strategicpatch.NewPatchMetaFromStruct(versionedObject)
-	if err != nil {
-		return nil, err
+	if lookup == nil {
+		return nil, errors.NewBadRequest(fmt.Sprintf("strategic merge patch is not supported for %s, "+
+			"it is not in the scheme and has no CustomResourceDefinition with a schema in git", gvk))
 	}
+
 	originalMap := map[string]interface{}{}
 	patchMap := map[string]interface{}{}
 	if err := json.Unmarshal(original, &originalMap); err != nil {
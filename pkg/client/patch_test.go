@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/git"
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/store"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	widgetCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  scope: Namespaced
+  names:
+    kind: Widget
+    plural: widgets
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              ports:
+                type: array
+                x-kubernetes-list-type: map
+                x-kubernetes-list-map-keys:
+                - name
+                items:
+                  type: object
+                  properties:
+                    name:
+                      type: string
+                    port:
+                      type: integer
+              tags:
+                type: array
+                x-kubernetes-list-type: set
+                items:
+                  type: string
+              args:
+                type: array
+                x-kubernetes-list-type: atomic
+                items:
+                  type: string
+`
+	widget = `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+  namespace: ns
+spec:
+  ports:
+  - name: a
+    port: 1
+  - name: b
+    port: 2
+  tags:
+  - red
+  - green
+  args:
+  - one
+  - two
+`
+	gadgetCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: gadgets.example.com
+spec:
+  group: example.com
+  scope: Namespaced
+  names:
+    kind: Gadget
+    plural: gadgets
+  versions:
+  - name: v1
+    served: true
+    storage: true
+`
+	gadget = `apiVersion: example.com/v1
+kind: Gadget
+metadata:
+  name: gadget
+  namespace: ns
+spec:
+  args:
+  - one
+`
+)
+
+// newRepo creates a bare repository with files committed on master and returns its URL
+func newRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	// go-git runs git-upload-pack and git-receive-pack for local repositories
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	remote := t.TempDir()
+	if _, err := gogit.PlainInit(remote, true); err != nil {
+		t.Fatal(err)
+	}
+
+	seed := t.TempDir()
+	repo, err := gogit.PlainInit(seed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(seed, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := worktree.Add(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := worktree.Commit("seed", &gogit.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@localhost", When: time.Now()},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{
+		Name: gogit.DefaultRemoteName,
+		URLs: []string{remote},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Push(&gogit.PushOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return remote
+}
+
+// newTestClient returns a client without a scheme for a store started on a repository with
+// files
+func newTestClient(t *testing.T, files map[string]string) *Client {
+	t.Helper()
+
+	s, err := store.New(newRepo(t, files), store.Options{
+		Git: git.Options{Branch: "master"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		s.Close()
+	})
+	if err := s.Start(ctx, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(nil, nil, s, "")
+}
+
+func TestStrategicMergePatchCRDSchema(t *testing.T) {
+	c := newTestClient(t, map[string]string{
+		"crd.yaml":    widgetCRD,
+		"widget.yaml": widget,
+	})
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("example.com/v1")
+	obj.SetKind("Widget")
+	obj.SetNamespace("ns")
+	obj.SetName("widget")
+	patch := client.RawPatch(types.StrategicMergePatchType,
+		[]byte(`{"spec":{"ports":[{"name":"b","port":3}],"tags":["blue"],"args":["three"]}}`))
+	if err := c.Patch(context.Background(), obj, patch); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		field    string
+		set      bool
+		expected []interface{}
+	}{
+		{
+			name:  "map list merged by key",
+			field: "ports",
+			expected: []interface{}{
+				map[string]interface{}{"name": "a", "port": int64(1)},
+				map[string]interface{}{"name": "b", "port": int64(3)},
+			},
+		},
+		{
+			name:     "set list merged",
+			field:    "tags",
+			set:      true,
+			expected: []interface{}{"blue", "green", "red"},
+		},
+		{
+			name:     "atomic list replaced",
+			field:    "args",
+			expected: []interface{}{"three"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, _, err := unstructured.NestedSlice(obj.Object, "spec", tt.field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.set {
+				// the order of a set is not kept without $setElementOrder
+				sort.Slice(value, func(i, j int) bool {
+					return value[i].(string) < value[j].(string)
+				})
+			}
+			if !reflect.DeepEqual(value, tt.expected) {
+				t.Errorf("%s is %v, expected %v", tt.field, value, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStrategicMergePatchNoSchema(t *testing.T) {
+	c := newTestClient(t, map[string]string{
+		"crd.yaml":    gadgetCRD,
+		"gadget.yaml": gadget,
+	})
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("example.com/v1")
+	obj.SetKind("Gadget")
+	obj.SetNamespace("ns")
+	obj.SetName("gadget")
+	patch := client.RawPatch(types.StrategicMergePatchType, []byte(`{"spec":{"args":["two"]}}`))
+	err := c.Patch(context.Background(), obj, patch)
+	if !errors.IsBadRequest(err) {
+		t.Fatalf("expected a BadRequest, got %v", err)
+	}
+
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(obj), obj); err != nil {
+		t.Fatal(err)
+	}
+	args, _, _ := unstructured.NestedStringSlice(obj.Object, "spec", "args")
+	if !reflect.DeepEqual(args, []string{"one"}) {
+		t.Errorf("args is %v, expected the patch to not be applied", args)
+	}
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/mapping"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/kube-openapi/pkg/util/proto"
+)
+
+// patchMeta returns the strategic merge patch metadata of gvk, from the scheme or else the
+// schema of the CustomResourceDefinition of gvk in git. It returns nil if there is neither.
+func (c *Client) patchMeta(gvk schema.GroupVersionKind) (strategicpatch.LookupPatchMeta, error) {
+	if c.scheme != nil && c.scheme.Recognizes(gvk) {
+		obj, err := c.scheme.New(gvk)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := obj.(runtime.Unstructured); !ok {
+			return strategicpatch.NewPatchMetaFromStruct(obj)
+		}
+	}
+
+	list, ok := c.store.List(mapping.CRDGroupVersionKind, "", nil).(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+	crds, _ := list.Object["items"].([]runtime.Object)
+	openAPISchema := mapping.OpenAPISchema(crds, gvk)
+	if openAPISchema == nil {
+		return nil, nil
+	}
+
+	path := proto.NewPath(gvk.Kind)
+	return schemaPatchMeta{
+		LookupPatchMeta: strategicpatch.NewPatchMetaFromOpenAPI(mapping.ToProto(openAPISchema, &path)),
+		root:            true,
+	}, nil
+}
+
+// schemaPatchMeta looks up patch metadata in the schema of a CustomResourceDefinition. Fields
+// that are not in the schema have no patch metadata, so they are merged like a JSON merge
+// patch does. The metadata of the object always comes from ObjectMeta.
+type schemaPatchMeta struct {
+	strategicpatch.LookupPatchMeta
+	root bool
+}
+
+func (s schemaPatchMeta) LookupPatchMetadataForStruct(key string) (strategicpatch.LookupPatchMeta, strategicpatch.PatchMeta, error) {
+	if s.root && key == "metadata" {
+		meta, err := strategicpatch.NewPatchMetaFromStruct(&metav1.ObjectMeta{})
+		return meta, strategicpatch.PatchMeta{}, err
+	}
+	return s.wrap(s.LookupPatchMeta.LookupPatchMetadataForStruct(key))
+}
+
+func (s schemaPatchMeta) LookupPatchMetadataForSlice(key string) (strategicpatch.LookupPatchMeta, strategicpatch.PatchMeta, error) {
+	return s.wrap(s.LookupPatchMeta.LookupPatchMetadataForSlice(key))
+}
+
+func (s schemaPatchMeta) Name() string {
+	if meta, ok := s.LookupPatchMeta.(strategicpatch.PatchMetaFromOpenAPI); ok && meta.Schema == nil {
+		return ""
+	}
+	return s.LookupPatchMeta.Name()
+}
+
+func (s schemaPatchMeta) wrap(lookup strategicpatch.LookupPatchMeta, meta strategicpatch.PatchMeta, err error) (strategicpatch.LookupPatchMeta, strategicpatch.PatchMeta, error) {
+	if _, ok := err.(strategicpatch.FieldNotFoundError); ok {
+		lookup, meta, err = nil, strategicpatch.PatchMeta{}, nil
+	}
+	if err != nil {
+		return nil, meta, err
+	}
+	if lookup == nil {
+		// arbitrary or unknown fields
+		lookup = strategicpatch.PatchMetaFromOpenAPI{}
+	}
+	return schemaPatchMeta{
+		LookupPatchMeta: lookup,
+	}, meta, nil
+}
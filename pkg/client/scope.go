@@ -0,0 +1,76 @@
+package client
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Namespaced returns true if objects of gvk are namespaced. Kinds unknown to the RESTMapper
+// are treated as namespaced.
+func (c *Client) Namespaced(gvk schema.GroupVersionKind) (bool, error) {
+	if c.mapper == nil {
+		return true, nil
+	}
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return mapping.Scope.Name() == meta.RESTScopeNameNamespace, nil
+}
+
+// Namespace returns the namespace to look up an object of gvk in. The namespace is ignored
+// for cluster scoped kinds and defaulted for namespaced kinds.
+func (c *Client) Namespace(gvk schema.GroupVersionKind, namespace string) (string, error) {
+	namespaced, err := c.Namespaced(gvk)
+	if err != nil {
+		return "", err
+	}
+	if !namespaced {
+		return "", nil
+	}
+	if namespace == "" {
+		namespace = c.defaultNamespace
+	}
+	if namespace == "" {
+		return "", errors.NewBadRequest(fmt.Sprintf("a namespace is required for %s", gvk.Kind))
+	}
+	return namespace, nil
+}
+
+// ListNamespace returns the namespace to list objects of gvk in, "" for all namespaces
+func (c *Client) ListNamespace(gvk schema.GroupVersionKind, namespace string) (string, error) {
+	namespaced, err := c.Namespaced(gvk)
+	if err != nil || !namespaced {
+		return "", err
+	}
+	return namespace, nil
+}
+
+// setNamespace checks the namespace of obj against the scope of gvk, defaulting it for
+// namespaced kinds
+func (c *Client) setNamespace(gvk schema.GroupVersionKind, obj client.Object) error {
+	namespaced, err := c.Namespaced(gvk)
+	if err != nil {
+		return err
+	}
+	if !namespaced {
+		if obj.GetNamespace() != "" {
+			return errors.NewBadRequest(fmt.Sprintf("%s %s is cluster scoped, namespace must not be set",
+				gvk.Kind, obj.GetName()))
+		}
+		return nil
+	}
+
+	namespace, err := c.Namespace(gvk, obj.GetNamespace())
+	if err != nil {
+		return err
+	}
+	obj.SetNamespace(namespace)
+	return nil
+}
@@ -14,19 +14,40 @@ type statusWriter struct {
 }
 
 func (sw *statusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
-	newStatus := &unstructured.Unstructured{}
-	if err := Convert(newStatus, obj); err != nil {
+	gvk, err := sw.client.gvk(obj)
+	if err != nil {
 		return err
 	}
 
-	gvk, err := sw.client.gvk(obj)
+	existing, err := sw.client.withStatus(gvk, obj)
 	if err != nil {
 		return err
 	}
 
-	existing := sw.client.store.Get(gvk, obj.GetNamespace(), obj.GetName())
+	updateOptions := client.UpdateOptions{}
+	updateOptions.ApplyOptions(opts)
+	ret, err := sw.client.store.Update(withFieldManager(ctx, updateOptions.FieldManager), gvk, existing, false)
+	if err != nil {
+		return err
+	}
+
+	return Convert(obj, ret)
+}
+
+// withStatus returns the stored object with the status and resourceVersion of obj
+func (c *Client) withStatus(gvk schema.GroupVersionKind, obj client.Object) (client.Object, error) {
+	if err := c.setNamespace(gvk, obj); err != nil {
+		return nil, err
+	}
+
+	newStatus := &unstructured.Unstructured{}
+	if err := Convert(newStatus, obj); err != nil {
+		return nil, err
+	}
+
+	existing := c.store.Get(gvk, obj.GetNamespace(), obj.GetName())
 	if existing == nil {
-		return errors.NewNotFound(schema.GroupResource{
+		return nil, errors.NewNotFound(schema.GroupResource{
 			Group:    gvk.Group,
 			Resource: gvk.Kind,
 		}, obj.GetName())
@@ -34,14 +55,27 @@ func (sw *statusWriter) Update(ctx context.Context, obj client.Object, opts ...c
 
 	existing = existing.DeepCopyObject().(client.Object)
 	existing.SetResourceVersion(newStatus.GetResourceVersion())
-	existing.(*unstructured.Unstructured).Object["status"] = newStatus.Object["status"]
-
-	ret, err := sw.client.store.Update(ctx, gvk, existing, false)
-	if err != nil {
-		return err
+	if status, ok := newStatus.Object["status"]; ok {
+		existing.(*unstructured.Unstructured).Object["status"] = status
+	} else {
+		delete(existing.(*unstructured.Unstructured).Object, "status")
 	}
+	return existing, nil
+}
 
-	return Convert(obj, ret)
+// statusOnly returns the apply configuration obj without the fields other than the status
+func statusOnly(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	result := &unstructured.Unstructured{
+		Object: map[string]interface{}{},
+	}
+	result.SetGroupVersionKind(obj.GroupVersionKind())
+	result.SetNamespace(obj.GetNamespace())
+	result.SetName(obj.GetName())
+	result.SetResourceVersion(obj.GetResourceVersion())
+	if status, ok := obj.Object["status"]; ok {
+		result.Object["status"] = status
+	}
+	return result
 }
 
 func (sw *statusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/store"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Transaction stages writes that are committed as a single git commit by Commit. The
+// staged objects are updated with the result of the commit just like a normal write.
+type Transaction struct {
+	client  *Client
+	tx      *store.Transaction
+	objects []client.Object
+}
+
+func (c *Client) Begin() *Transaction {
+	return &Transaction{
+		client: c,
+		tx:     c.store.Begin(),
+	}
+}
+
+func (t *Transaction) Create(obj client.Object) error {
+	gvk, err := t.client.gvk(obj)
+	if err != nil {
+		return err
+	}
+	if err := t.client.setNamespace(gvk, obj); err != nil {
+		return err
+	}
+	t.tx.Create(gvk, obj)
+	t.objects = append(t.objects, obj)
+	return nil
+}
+
+func (t *Transaction) Update(obj client.Object) error {
+	gvk, err := t.client.gvk(obj)
+	if err != nil {
+		return err
+	}
+	if err := t.client.setNamespace(gvk, obj); err != nil {
+		return err
+	}
+	t.tx.Update(gvk, obj)
+	t.objects = append(t.objects, obj)
+	return nil
+}
+
+// UpdateStatus stages a write of only the status of obj
+func (t *Transaction) UpdateStatus(obj client.Object) error {
+	gvk, err := t.client.gvk(obj)
+	if err != nil {
+		return err
+	}
+
+	existing, err := t.client.withStatus(gvk, obj)
+	if err != nil {
+		return err
+	}
+
+	t.tx.UpdateStatus(gvk, existing)
+	t.objects = append(t.objects, obj)
+	return nil
+}
+
+func (t *Transaction) Delete(obj client.Object, opts ...client.DeleteOption) error {
+	gvk, err := t.client.gvk(obj)
+	if err != nil {
+		return err
+	}
+
+	namespace, err := t.client.Namespace(gvk, obj.GetNamespace())
+	if err != nil {
+		return err
+	}
+
+	deleteOptions := client.DeleteOptions{}
+	for _, opt := range opts {
+		opt.ApplyToDelete(&deleteOptions)
+	}
+	t.tx.Delete(gvk, namespace, obj.GetName(), deleteOptions.Preconditions)
+	t.objects = append(t.objects, nil)
+	return nil
+}
+
+// Commit commits and pushes all staged writes. If any write fails its preconditions no
+// writes are committed.
+func (t *Transaction) Commit(ctx context.Context) error {
+	result, err := t.tx.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i, obj := range t.objects {
+		if obj == nil || result[i] == nil {
+			continue
+		}
+		if err := Convert(obj, result[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
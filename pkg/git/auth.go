@@ -0,0 +1,163 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Auth holds the credentials used to clone, fetch and push. The SSH fields are used for
+// ssh URLs and Username/Password for http(s) URLs. When nothing applies to the URL the
+// ambient configuration (ssh-agent, credential helpers) is used.
+type Auth struct {
+	// SSHUser defaults to the user in the URL or "git"
+	SSHUser               string
+	SSHPrivateKey         []byte
+	SSHPrivateKeyPassword string
+	// SSHKnownHosts is the content of a known_hosts file used to verify the server. If
+	// empty the default known_hosts files of the current user are used.
+	SSHKnownHosts []byte
+
+	// Username defaults to "git" if only Password is set, which is what most hosts
+	// expect when Password is a token
+	Username string
+	Password string
+}
+
+// AuthProvider is called before every remote operation so that credentials, such as
+// short lived tokens, can be rotated.
+type AuthProvider func(ctx context.Context, url string) (*Auth, error)
+
+func StaticAuth(auth Auth) AuthProvider {
+	return func(context.Context, string) (*Auth, error) {
+		return &auth, nil
+	}
+}
+
+func (a *Auth) ssh() bool {
+	return a != nil && len(a.SSHPrivateKey) > 0
+}
+
+func (a *Auth) basic() bool {
+	return a != nil && (a.Username != "" || a.Password != "")
+}
+
+func (a *Auth) username() string {
+	if a.Username == "" {
+		return "git"
+	}
+	return a.Username
+}
+
+func (a *Auth) sshUser(endpoint *transport.Endpoint) string {
+	if a.SSHUser != "" {
+		return a.SSHUser
+	}
+	if endpoint.User != "" {
+		return endpoint.User
+	}
+	return "git"
+}
+
+// writeKnownHosts writes the known hosts to a file in dir, returning "" if there are none
+func (a *Auth) writeKnownHosts(dir string) (string, error) {
+	if len(a.SSHKnownHosts) == 0 {
+		return "", nil
+	}
+	file := filepath.Join(dir, "known_hosts")
+	return file, ioutil.WriteFile(file, a.SSHKnownHosts, 0600)
+}
+
+func resolveAuth(ctx context.Context, provider AuthProvider, url string) (*Auth, error) {
+	if provider == nil {
+		return nil, nil
+	}
+	auth, err := provider(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials for %s: %w", Redact(url), err)
+	}
+	return auth, nil
+}
+
+// authMethod converts auth to the go-git equivalent for the given URL
+func authMethod(auth *Auth, u string) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(u)
+	if err != nil {
+		return nil, err
+	}
+
+	switch endpoint.Protocol {
+	case "ssh":
+		if !auth.ssh() {
+			return nil, nil
+		}
+		keys, err := ssh.NewPublicKeys(auth.sshUser(endpoint), auth.SSHPrivateKey, auth.SSHPrivateKeyPassword)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ssh private key: %w", err)
+		}
+		keys.HostKeyCallback, err = knownHostsCallback(auth)
+		if err != nil {
+			return nil, err
+		}
+		return keys, nil
+	case "http", "https":
+		if !auth.basic() {
+			return nil, nil
+		}
+		return &http.BasicAuth{
+			Username: auth.username(),
+			Password: auth.Password,
+		}, nil
+	}
+
+	return nil, nil
+}
+
+func knownHostsCallback(auth *Auth) (gossh.HostKeyCallback, error) {
+	if len(auth.SSHKnownHosts) == 0 {
+		return ssh.NewKnownHostsCallback()
+	}
+
+	dir, err := ioutil.TempDir("", "gitbacked-known-hosts-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	file, err := auth.writeKnownHosts(dir)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.NewKnownHostsCallback(file)
+}
+
+var urlUserInfo = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://)[^/@\s]+@`)
+
+// Redact removes any credentials embedded in URLs found in s so it is safe to log
+func Redact(s string) string {
+	return urlUserInfo.ReplaceAllStringFunc(s, func(match string) string {
+		scheme := match[:strings.Index(match, "://")+3]
+		// a bare ssh user name is not a secret
+		if strings.HasPrefix(scheme, "ssh") && !strings.Contains(match[len(scheme):], ":") {
+			return match
+		}
+		return scheme + "xxxxx@"
+	})
+}
+
+func redactAll(args []string) string {
+	result := make([]string, 0, len(args))
+	for _, arg := range args {
+		result = append(result, Redact(arg))
+	}
+	return strings.Join(result, " ")
+}
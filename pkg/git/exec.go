@@ -0,0 +1,190 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const credentialHelper = `!f() { test "$1" = get || exit 0; echo "username=${GITBACKED_USERNAME}"; echo "password=${GITBACKED_PASSWORD}"; }; f`
+
+// execBackend runs the git binary found in the PATH
+type execBackend struct {
+	dir  string
+	url  string
+	auth AuthProvider
+}
+
+// remote runs a git command that talks to the remote, passing credentials through the
+// environment so they never show up in the arguments
+func (e *execBackend) remote(ctx context.Context, dir string, args ...string) error {
+	auth, err := resolveAuth(ctx, e.auth, e.url)
+	if err != nil {
+		return err
+	}
+
+	var env []string
+	switch {
+	case auth.ssh():
+		if auth.SSHPrivateKeyPassword != "" {
+			return fmt.Errorf("ssh private keys with a password are not supported by the exec git backend")
+		}
+
+		tmp, err := ioutil.TempDir("", "gitbacked-ssh-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+
+		keyFile := filepath.Join(tmp, "id")
+		if err := ioutil.WriteFile(keyFile, auth.SSHPrivateKey, 0600); err != nil {
+			return err
+		}
+		sshCommand := fmt.Sprintf("ssh -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=yes", keyFile)
+		if knownHosts, err := auth.writeKnownHosts(tmp); err != nil {
+			return err
+		} else if knownHosts != "" {
+			sshCommand += " -o UserKnownHostsFile=" + knownHosts
+		}
+		if auth.SSHUser != "" {
+			sshCommand += " -l " + auth.SSHUser
+		}
+		env = append(env, "GIT_SSH_COMMAND="+sshCommand)
+	case auth.basic():
+		env = append(env,
+			"GITBACKED_USERNAME="+auth.username(),
+			"GITBACKED_PASSWORD="+auth.Password,
+			"GIT_TERMINAL_PROMPT=0")
+		args = append([]string{"-c", "credential.helper=", "-c", "credential.helper=" + credentialHelper}, args...)
+	}
+
+	_, err = gitWithEnv(ctx, dir, env, args...)
+	return err
+}
+
+func (e *execBackend) Clone(ctx context.Context, url, branch, dir string) error {
+	args := []string{"clone"}
+	if branch != "" {
+		args = append(args, "-b", branch)
+	}
+	args = append(args, url, dir)
+
+	e.url = url
+	if err := e.remote(ctx, "", args...); err != nil {
+		return err
+	}
+
+	e.dir = dir
+	return nil
+}
+
+func (e *execBackend) Fetch(ctx context.Context) error {
+	return e.remote(ctx, e.dir, "fetch")
+}
+
+func (e *execBackend) Pull(ctx context.Context) error {
+	return e.remote(ctx, e.dir, "pull", "-r")
+}
+
+func (e *execBackend) Add(ctx context.Context, path string) error {
+	_, err := git(ctx, e.dir, "add", path)
+	return err
+}
+
+func (e *execBackend) Remove(ctx context.Context, path string) error {
+	_, err := git(ctx, e.dir, "rm", "-f", path)
+	return err
+}
+
+func (e *execBackend) Commit(ctx context.Context, message string, author, committer *Signature) error {
+	var env []string
+	if author != nil {
+		env = append(env, "GIT_AUTHOR_NAME="+author.Name, "GIT_AUTHOR_EMAIL="+author.Email)
+	}
+	if committer != nil {
+		env = append(env, "GIT_COMMITTER_NAME="+committer.Name, "GIT_COMMITTER_EMAIL="+committer.Email)
+	}
+	_, err := gitWithEnv(ctx, e.dir, env, "commit", "-m", message)
+	return err
+}
+
+func (e *execBackend) Push(ctx context.Context) error {
+	return e.remote(ctx, e.dir, "push")
+}
+
+func (e *execBackend) Reset(ctx context.Context) error {
+	_, err := git(ctx, e.dir, "reset", "--hard", "@{upstream}")
+	return err
+}
+
+func (e *execBackend) Head(ctx context.Context) (string, error) {
+	buf, err := git(ctx, e.dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func (e *execBackend) CommitCount(ctx context.Context) (int, error) {
+	buf, err := git(ctx, e.dir, "rev-list", "--count", "HEAD")
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(buf.String()))
+}
+
+func (e *execBackend) Diff(ctx context.Context, from, to string) ([]string, error) {
+	buf, err := git(ctx, e.dir, "diff", "--name-only", "--no-renames", "-z", from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, path := range strings.Split(buf.String(), "\x00") {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+func git(ctx context.Context, dir string, args ...string) (*bytes.Buffer, error) {
+	return gitWithEnv(ctx, dir, nil, args...)
+}
+
+func gitWithEnv(ctx context.Context, dir string, env []string, args ...string) (*bytes.Buffer, error) {
+	logrus.Info("git ", redactAll(args))
+
+	errBuffer := &bytes.Buffer{}
+	defer func() {
+		os.Stderr.WriteString(Redact(errBuffer.String()))
+	}()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = errBuffer
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	outBuffer := &bytes.Buffer{}
+	cmd.Stdout = io.MultiWriter(outBuffer, os.Stdout)
+
+	err := cmd.Run()
+	if err != nil {
+		logrus.Error("git ", redactAll(args), ":", err)
+	}
+
+	return outBuffer, err
+}
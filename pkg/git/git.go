@@ -1,23 +1,65 @@
 package git
 
 import (
-	"bytes"
 	"context"
-	"io"
+	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+)
+
+type BackendType string
 
-	"github.com/sirupsen/logrus"
-	"golang.org/x/sync/errgroup"
+const (
+	BackendNative BackendType = "native"
+	BackendExec   BackendType = "exec"
 )
 
+// Backend performs the actual git operations for a Repo. Paths passed to a backend are
+// relative to the root of the working tree.
+type Backend interface {
+	Clone(ctx context.Context, url, branch, dir string) error
+	Fetch(ctx context.Context) error
+	Pull(ctx context.Context) error
+	Add(ctx context.Context, path string) error
+	Remove(ctx context.Context, path string) error
+	Commit(ctx context.Context, message string, author, committer *Signature) error
+	Push(ctx context.Context) error
+	Reset(ctx context.Context) error
+	Head(ctx context.Context) (string, error)
+	// CommitCount returns the number of commits reachable from HEAD
+	CommitCount(ctx context.Context) (int, error)
+	// Diff returns the paths of the files that differ between two commits
+	Diff(ctx context.Context, from, to string) ([]string, error)
+}
+
+// Signature identifies the author or committer of a commit
+type Signature struct {
+	Name  string
+	Email string
+}
+
+type Options struct {
+	Branch  string
+	Backend BackendType
+	// AuthProvider supplies the credentials for every clone, fetch and push
+	AuthProvider AuthProvider
+	// Author of the commits, if nil user.name and user.email of the git configuration of
+	// the host are used. The native backend falls back to gitbacked-controller
+	// <gitbacked-controller@localhost> if they are not set, the exec backend leaves it to git.
+	Author *Signature
+	// Committer of the commits, defaults to Author
+	Committer *Signature
+}
+
 type Repo struct {
-	Dir    string
-	url    string
-	branch string
+	Dir       string
+	url       string
+	branch    string
+	author    *Signature
+	committer *Signature
+	backend   Backend
 }
 
 func (r *Repo) Close() error {
@@ -25,15 +67,20 @@ func (r *Repo) Close() error {
 }
 
 func (r *Repo) Update(ctx context.Context) (string, error) {
-	_, err := git(ctx, r.Dir, "pull", "-r")
-	if err != nil {
+	if err := r.backend.Pull(ctx); err != nil {
 		return "", err
 	}
 
 	return r.Head(ctx)
 }
 
-func (r *Repo) Add(ctx context.Context, path string, data []byte) error {
+// Write writes data to path and stages it for the next commit
+func (r *Repo) Write(ctx context.Context, path string, data []byte) error {
+	rel, err := r.rel(path)
+	if err != nil {
+		return err
+	}
+
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
@@ -41,101 +88,137 @@ func (r *Repo) Add(ctx context.Context, path string, data []byte) error {
 	if err := ioutil.WriteFile(path, data, 0644); err != nil {
 		return err
 	}
-	_, err := git(ctx, r.Dir, "add", path)
-	if err != nil {
+	if err := r.backend.Add(ctx, rel); err != nil {
 		os.Remove(path)
 		return err
 	}
 
-	return r.commitAndPush(ctx)
+	return nil
 }
 
-func (r *Repo) Delete(ctx context.Context, path string) error {
-	_, err := git(ctx, r.Dir, "rm", "-f", path)
+// Remove deletes path and stages the removal for the next commit
+func (r *Repo) Remove(ctx context.Context, path string) error {
+	rel, err := r.rel(path)
 	if err != nil {
 		return err
 	}
 
-	return r.commitAndPush(ctx)
+	return r.backend.Remove(ctx, rel)
 }
 
-func (r *Repo) commitAndPush(ctx context.Context) error {
-	_, err := git(ctx, r.Dir, "commit", "-m", "controller update")
-	if err != nil {
-		git(ctx, r.Dir, "reset", "--hard", "origin/HEAD")
+// PushError is returned by Commit when the commit could not be pushed, typically because
+// the remote branch has moved
+type PushError struct {
+	Err error
+}
+
+func (p *PushError) Error() string {
+	return fmt.Sprintf("push failed: %v", p.Err)
+}
+
+func (p *PushError) Unwrap() error {
+	return p.Err
+}
+
+// Commit commits all staged changes and pushes them. On failure the working tree is reset
+// to the remote branch, discarding the staged changes.
+func (r *Repo) Commit(ctx context.Context, message string) error {
+	if err := r.backend.Commit(ctx, message, r.author, r.committer); err != nil {
+		r.backend.Reset(ctx)
 		return err
 	}
 
-	_, err = git(ctx, r.Dir, "push")
-	if err != nil {
-		git(ctx, r.Dir, "reset", "--hard", "origin/HEAD")
-		return err
+	if err := r.backend.Push(ctx); err != nil {
+		r.backend.Reset(ctx)
+		return &PushError{Err: err}
 	}
 
 	return nil
 }
 
-func (r *Repo) Head(ctx context.Context) (string, error) {
-	buf, err := git(ctx, r.Dir, "rev-parse", "HEAD")
-	if err != nil {
-		return "", err
+// Sync fetches the remote branch and resets the working tree to it, discarding any local
+// changes
+func (r *Repo) Sync(ctx context.Context) error {
+	if err := r.backend.Fetch(ctx); err != nil {
+		return err
 	}
+	return r.backend.Reset(ctx)
+}
 
-	return strings.TrimSpace(buf.String()), nil
+// Reset discards all uncommitted changes, resetting the working tree to the remote branch
+func (r *Repo) Reset(ctx context.Context) error {
+	return r.backend.Reset(ctx)
 }
 
-func New(ctx context.Context, url, branch string) (*Repo, error) {
-	d, err := ioutil.TempDir("", "gitbacked-controller-")
+func (r *Repo) Head(ctx context.Context) (string, error) {
+	return r.backend.Head(ctx)
+}
+
+func (r *Repo) CommitCount(ctx context.Context) (int, error) {
+	return r.backend.CommitCount(ctx)
+}
+
+// Diff returns the absolute paths of the files added, modified or removed between two commits
+func (r *Repo) Diff(ctx context.Context, from, to string) ([]string, error) {
+	paths, err := r.backend.Diff(ctx, from, to)
 	if err != nil {
 		return nil, err
 	}
-
-	if err := clone(ctx, url, branch, d); err != nil {
-		return nil, err
+	for i, path := range paths {
+		paths[i] = filepath.Join(r.Dir, filepath.FromSlash(path))
 	}
-
-	return &Repo{
-		Dir:    d,
-		url:    url,
-		branch: branch,
-	}, nil
+	return paths, nil
 }
 
-func clone(ctx context.Context, url, branch, dir string) error {
-	args := []string{"clone"}
-	if branch != "" {
-		args = append(args, "-b", branch)
+func (r *Repo) rel(path string) (string, error) {
+	rel, err := filepath.Rel(r.Dir, path)
+	if err != nil {
+		return "", err
 	}
-	args = append(args, url, dir)
-
-	_, err := git(ctx, "", args...)
-	return err
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside of repository %s", path, r.Dir)
+	}
+	return filepath.ToSlash(rel), nil
 }
 
-func git(ctx context.Context, dir string, args ...string) (*bytes.Buffer, error) {
-	logrus.Info("git ", strings.Join(args, " "))
+func newBackend(backendType BackendType, auth AuthProvider) (Backend, error) {
+	switch backendType {
+	case "", BackendNative:
+		return &nativeBackend{auth: auth}, nil
+	case BackendExec:
+		return &execBackend{auth: auth}, nil
+	default:
+		return nil, fmt.Errorf("unknown git backend %q", backendType)
+	}
+}
 
-	cmd := exec.CommandContext(ctx, "git", args...)
-	cmd.Dir = dir
-	cmd.Stderr = os.Stderr
+func New(ctx context.Context, url string, opts Options) (*Repo, error) {
+	backend, err := newBackend(opts.Backend, opts.AuthProvider)
+	if err != nil {
+		return nil, err
+	}
 
-	out, err := cmd.StdoutPipe()
+	d, err := ioutil.TempDir("", "gitbacked-controller-")
 	if err != nil {
 		return nil, err
 	}
 
-	outBuffer := &bytes.Buffer{}
-	eg := errgroup.Group{}
-	eg.Go(func() error {
-		_, err := io.Copy(outBuffer, io.TeeReader(out, os.Stdout))
-		return err
-	})
+	if err := backend.Clone(ctx, url, opts.Branch, d); err != nil {
+		os.RemoveAll(d)
+		return nil, err
+	}
 
-	err = cmd.Run()
-	if err != nil {
-		logrus.Error("git ", strings.Join(args, " "), ":", err)
+	committer := opts.Committer
+	if committer == nil {
+		committer = opts.Author
 	}
 
-	_ = eg.Wait()
-	return outBuffer, err
+	return &Repo{
+		Dir:       d,
+		url:       url,
+		branch:    opts.Branch,
+		author:    opts.Author,
+		committer: committer,
+		backend:   backend,
+	}, nil
 }
@@ -0,0 +1,504 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/sirupsen/logrus"
+)
+
+var defaultSignature = object.Signature{
+	Name:  "gitbacked-controller",
+	Email: "gitbacked-controller@localhost",
+}
+
+// nativeBackend implements git in process using go-git so no git binary is required
+type nativeBackend struct {
+	dir    string
+	url    string
+	branch string
+	auth   AuthProvider
+	repo   *gogit.Repository
+}
+
+func (n *nativeBackend) authMethod(ctx context.Context) (transport.AuthMethod, error) {
+	auth, err := resolveAuth(ctx, n.auth, n.url)
+	if err != nil {
+		return nil, err
+	}
+	return authMethod(auth, n.url)
+}
+
+func (n *nativeBackend) Clone(ctx context.Context, url, branch, dir string) error {
+	logrus.Infof("git clone %s", Redact(url))
+
+	n.url = url
+	auth, err := n.authMethod(ctx)
+	if err != nil {
+		return err
+	}
+
+	opts := &gogit.CloneOptions{
+		URL:  url,
+		Auth: auth,
+	}
+	if branch != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(branch)
+		opts.SingleBranch = true
+	}
+
+	repo, err := gogit.PlainCloneContext(ctx, dir, false, opts)
+	if err != nil {
+		return fmt.Errorf("git clone: %w", err)
+	}
+
+	if branch == "" {
+		head, err := repo.Head()
+		if err != nil {
+			return err
+		}
+		branch = head.Name().Short()
+	}
+
+	n.dir = dir
+	n.branch = branch
+	n.repo = repo
+	return nil
+}
+
+func (n *nativeBackend) remoteRef() plumbing.ReferenceName {
+	return plumbing.NewRemoteReferenceName(gogit.DefaultRemoteName, n.branch)
+}
+
+func (n *nativeBackend) Fetch(ctx context.Context) error {
+	logrus.Info("git fetch")
+
+	auth, err := n.authMethod(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = n.repo.FetchContext(ctx, &gogit.FetchOptions{
+		Auth: auth,
+		RefSpecs: []config.RefSpec{
+			config.RefSpec(fmt.Sprintf("+%s:%s", plumbing.NewBranchReferenceName(n.branch), n.remoteRef())),
+		},
+	})
+	if err == gogit.NoErrAlreadyUpToDate {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("git fetch: %w", err)
+	}
+	return nil
+}
+
+// Pull fetches the remote branch and then fast-forwards to it or, if the histories
+// diverged, rebases the local commits that were never pushed onto it. Commits that were
+// pushed before the remote branch was rewritten are dropped, like git pull --rebase does
+// using the fork point.
+func (n *nativeBackend) Pull(ctx context.Context) error {
+	var pushed plumbing.Hash
+	if ref, err := n.repo.Reference(n.remoteRef(), true); err == nil {
+		pushed = ref.Hash()
+	}
+
+	if err := n.Fetch(ctx); err != nil {
+		return err
+	}
+
+	local, remote, err := n.localAndRemote()
+	if err != nil {
+		return err
+	}
+
+	if local.Hash == remote.Hash {
+		return nil
+	}
+
+	if ok, err := local.IsAncestor(remote); err != nil {
+		return err
+	} else if ok {
+		return n.resetTo(remote.Hash)
+	}
+
+	if ok, err := remote.IsAncestor(local); err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+
+	if local.Hash == pushed {
+		// nothing unpushed, the remote branch was rewritten
+		return n.resetTo(remote.Hash)
+	}
+
+	return n.rebase(local, remote, pushed)
+}
+
+func (n *nativeBackend) localAndRemote() (*object.Commit, *object.Commit, error) {
+	head, err := n.repo.Head()
+	if err != nil {
+		return nil, nil, err
+	}
+	local, err := n.repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ref, err := n.repo.Reference(n.remoteRef(), true)
+	if err != nil {
+		return nil, nil, err
+	}
+	remote, err := n.repo.CommitObject(ref.Hash())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return local, remote, nil
+}
+
+// rebase replays the commits in local that are not in remote on top of remote. Replaying
+// a commit that touches a file that was also changed in remote is considered a conflict
+// and the rebase is aborted, leaving the branch as it was. pushed is the last known
+// remote head, commits reachable from it are not replayed.
+func (n *nativeBackend) rebase(local, remote *object.Commit, pushed plumbing.Hash) error {
+	logrus.Infof("git rebase %s", remote.Hash)
+
+	base, err := n.forkPoint(local, remote, pushed)
+	if err != nil {
+		return err
+	}
+
+	var commits []*object.Commit
+	for c := local; c.Hash != base.Hash; {
+		if c.NumParents() != 1 {
+			return fmt.Errorf("git rebase: can not rebase merge commit %s", c.Hash)
+		}
+		commits = append([]*object.Commit{c}, commits...)
+		c, err = c.Parent(0)
+		if err != nil {
+			return err
+		}
+	}
+
+	remoteChanges, err := changedPaths(base, remote)
+	if err != nil {
+		return err
+	}
+
+	if err := n.resetTo(remote.Hash); err != nil {
+		return err
+	}
+
+	for _, c := range commits {
+		if err := n.replay(c, remoteChanges); err != nil {
+			if resetErr := n.resetTo(local.Hash); resetErr != nil {
+				logrus.Errorf("failed to abort rebase: %v", resetErr)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forkPoint returns pushed if local is based on it and the merge base of local and remote
+// otherwise
+func (n *nativeBackend) forkPoint(local, remote *object.Commit, pushed plumbing.Hash) (*object.Commit, error) {
+	if c, err := n.repo.CommitObject(pushed); err == nil {
+		if ok, err := c.IsAncestor(local); err != nil {
+			return nil, err
+		} else if ok {
+			return c, nil
+		}
+	}
+
+	bases, err := local.MergeBase(remote)
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) == 0 {
+		return nil, fmt.Errorf("git rebase: no common ancestor between %s and %s", local.Hash, remote.Hash)
+	}
+	return bases[0], nil
+}
+
+func (n *nativeBackend) replay(c *object.Commit, remoteChanges map[string]bool) error {
+	parent, err := c.Parent(0)
+	if err != nil {
+		return err
+	}
+
+	changes, err := diff(parent, c)
+	if err != nil {
+		return err
+	}
+
+	wt, err := n.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		_, to, err := change.Files()
+		if err != nil {
+			return err
+		}
+
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		if remoteChanges[name] {
+			return fmt.Errorf("git rebase: conflict on %s replaying %s", name, c.Hash)
+		}
+
+		if to == nil {
+			if _, err := wt.Remove(name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := writeFile(filepath.Join(n.dir, filepath.FromSlash(name)), to); err != nil {
+			return err
+		}
+		if _, err := wt.Add(name); err != nil {
+			return err
+		}
+	}
+
+	_, err = wt.Commit(c.Message, &gogit.CommitOptions{
+		Author:    &c.Author,
+		Committer: n.signature(nil),
+	})
+	return err
+}
+
+func writeFile(path string, f *object.File) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	r, err := f.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, r)
+	return err
+}
+
+func diff(from, to *object.Commit) (object.Changes, error) {
+	fromTree, err := from.Tree()
+	if err != nil {
+		return nil, err
+	}
+	toTree, err := to.Tree()
+	if err != nil {
+		return nil, err
+	}
+	return object.DiffTree(fromTree, toTree)
+}
+
+func changedPaths(from, to *object.Commit) (map[string]bool, error) {
+	changes, err := diff(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]bool{}
+	for _, change := range changes {
+		if change.From.Name != "" {
+			result[change.From.Name] = true
+		}
+		if change.To.Name != "" {
+			result[change.To.Name] = true
+		}
+	}
+	return result, nil
+}
+
+func (n *nativeBackend) resetTo(hash plumbing.Hash) error {
+	wt, err := n.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	return wt.Reset(&gogit.ResetOptions{
+		Commit: hash,
+		Mode:   gogit.HardReset,
+	})
+}
+
+func (n *nativeBackend) Add(ctx context.Context, path string) error {
+	logrus.Infof("git add %s", path)
+
+	wt, err := n.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	_, err = wt.Add(path)
+	return err
+}
+
+func (n *nativeBackend) Remove(ctx context.Context, path string) error {
+	logrus.Infof("git rm %s", path)
+
+	wt, err := n.repo.Worktree()
+	if err != nil {
+		return err
+	}
+	_, err = wt.Remove(path)
+	return err
+}
+
+// signature returns sig or, like git, the user of the git configuration if sig is nil.
+// defaultSignature is used for what is not configured.
+func (n *nativeBackend) signature(sig *Signature) *object.Signature {
+	result := defaultSignature
+	if sig != nil {
+		result.Name = sig.Name
+		result.Email = sig.Email
+	} else if cfg, err := n.repo.ConfigScoped(config.SystemScope); err != nil {
+		logrus.Warnf("failed to read git config: %v", err)
+	} else {
+		if cfg.User.Name != "" {
+			result.Name = cfg.User.Name
+		}
+		if cfg.User.Email != "" {
+			result.Email = cfg.User.Email
+		}
+	}
+	result.When = time.Now()
+	return &result
+}
+
+func (n *nativeBackend) Commit(ctx context.Context, message string, author, committer *Signature) error {
+	logrus.Infof("git commit -m %q", message)
+
+	wt, err := n.repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	status, err := wt.Status()
+	if err != nil {
+		return err
+	}
+	if status.IsClean() {
+		return fmt.Errorf("git commit: nothing to commit")
+	}
+
+	_, err = wt.Commit(message, &gogit.CommitOptions{
+		Author:    n.signature(author),
+		Committer: n.signature(committer),
+	})
+	return err
+}
+
+func (n *nativeBackend) Push(ctx context.Context) error {
+	logrus.Info("git push")
+
+	auth, err := n.authMethod(ctx)
+	if err != nil {
+		return err
+	}
+
+	ref := plumbing.NewBranchReferenceName(n.branch)
+	err = n.repo.PushContext(ctx, &gogit.PushOptions{
+		Auth: auth,
+		RefSpecs: []config.RefSpec{
+			config.RefSpec(fmt.Sprintf("%s:%s", ref, ref)),
+		},
+	})
+	if err == gogit.NoErrAlreadyUpToDate {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("git push: %w", err)
+	}
+
+	head, err := n.repo.Head()
+	if err != nil {
+		return err
+	}
+	return n.repo.Storer.SetReference(plumbing.NewHashReference(n.remoteRef(), head.Hash()))
+}
+
+func (n *nativeBackend) Reset(ctx context.Context) error {
+	logrus.Info("git reset --hard @{upstream}")
+
+	ref, err := n.repo.Reference(n.remoteRef(), true)
+	if err != nil {
+		return err
+	}
+	return n.resetTo(ref.Hash())
+}
+
+func (n *nativeBackend) Head(ctx context.Context) (string, error) {
+	head, err := n.repo.Head()
+	if err != nil {
+		return "", err
+	}
+	return head.Hash().String(), nil
+}
+
+func (n *nativeBackend) Diff(ctx context.Context, from, to string) ([]string, error) {
+	fromCommit, err := n.repo.CommitObject(plumbing.NewHash(from))
+	if err != nil {
+		return nil, err
+	}
+	toCommit, err := n.repo.CommitObject(plumbing.NewHash(to))
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := changedPaths(fromCommit, toCommit)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(changed))
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (n *nativeBackend) CommitCount(ctx context.Context) (int, error) {
+	head, err := n.repo.Head()
+	if err != nil {
+		return 0, err
+	}
+
+	commits, err := n.repo.Log(&gogit.LogOptions{
+		From: head.Hash(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = commits.ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	})
+	return count, err
+}
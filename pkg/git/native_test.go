@@ -0,0 +1,299 @@
+package git
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// newRemote creates a bare repository with a single commit on master and returns its URL
+func newRemote(t *testing.T) string {
+	t.Helper()
+
+	// go-git runs git-upload-pack and git-receive-pack for local repositories
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	remote := t.TempDir()
+	if _, err := gogit.PlainInit(remote, true); err != nil {
+		t.Fatal(err)
+	}
+
+	seed := t.TempDir()
+	repo, err := gogit.PlainInit(seed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{
+		Name: gogit.DefaultRemoteName,
+		URLs: []string{remote},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := &nativeBackend{dir: seed, branch: "master", repo: repo}
+	commitFile(t, n, "README.md", "seed")
+	if err := n.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return remote
+}
+
+func clone(t *testing.T, url string) *nativeBackend {
+	t.Helper()
+
+	n := &nativeBackend{}
+	if err := n.Clone(context.Background(), url, "master", t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func commitFile(t *testing.T, n *nativeBackend, name, content string) string {
+	t.Helper()
+
+	ctx := context.Background()
+	if err := ioutil.WriteFile(filepath.Join(n.dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Add(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Commit(ctx, "write "+name, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return head(t, n)
+}
+
+func push(t *testing.T, n *nativeBackend) {
+	t.Helper()
+
+	if err := n.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// forcePush resets n to hash, commits name and force pushes the result
+func forcePush(t *testing.T, n *nativeBackend, hash, name string) string {
+	t.Helper()
+
+	if err := n.resetTo(plumbing.NewHash(hash)); err != nil {
+		t.Fatal(err)
+	}
+	result := commitFile(t, n, name, name)
+	if err := n.repo.Push(&gogit.PushOptions{
+		RefSpecs: []config.RefSpec{"+refs/heads/master:refs/heads/master"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func pull(t *testing.T, n *nativeBackend) {
+	t.Helper()
+
+	if err := n.Pull(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func head(t *testing.T, n *nativeBackend) string {
+	t.Helper()
+
+	hash, err := n.Head(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func parent(t *testing.T, n *nativeBackend) string {
+	t.Helper()
+
+	c, err := n.repo.CommitObject(plumbing.NewHash(head(t, n)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.Parent(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Hash.String()
+}
+
+func commitCount(t *testing.T, n *nativeBackend) int {
+	t.Helper()
+
+	count, err := n.CommitCount(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func assertFiles(t *testing.T, n *nativeBackend, present []string, absent []string) {
+	t.Helper()
+
+	for _, name := range present {
+		if _, err := os.Stat(filepath.Join(n.dir, name)); err != nil {
+			t.Errorf("expected %s: %v", name, err)
+		}
+	}
+	for _, name := range absent {
+		if _, err := os.Stat(filepath.Join(n.dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to not exist: %v", name, err)
+		}
+	}
+}
+
+func TestNativeClone(t *testing.T) {
+	n := clone(t, newRemote(t))
+
+	if n.branch != "master" {
+		t.Errorf("branch = %q, expected master", n.branch)
+	}
+	if count := commitCount(t, n); count != 1 {
+		t.Errorf("commit count = %d, expected 1", count)
+	}
+	assertFiles(t, n, []string{"README.md"}, nil)
+}
+
+func TestNativePullFastForward(t *testing.T) {
+	url := newRemote(t)
+	a, b := clone(t, url), clone(t, url)
+
+	pushed := commitFile(t, b, "b", "b")
+	push(t, b)
+	pull(t, a)
+
+	if got := head(t, a); got != pushed {
+		t.Errorf("head = %s, expected %s", got, pushed)
+	}
+	assertFiles(t, a, []string{"b"}, nil)
+}
+
+func TestNativePullDiverged(t *testing.T) {
+	url := newRemote(t)
+	a, b := clone(t, url), clone(t, url)
+
+	commitFile(t, a, "a", "a")
+	pushed := commitFile(t, b, "b", "b")
+	push(t, b)
+	pull(t, a)
+
+	if got := parent(t, a); got != pushed {
+		t.Errorf("local commit rebased onto %s, expected %s", got, pushed)
+	}
+	if count := commitCount(t, a); count != 3 {
+		t.Errorf("commit count = %d, expected 3", count)
+	}
+	assertFiles(t, a, []string{"a", "b"}, nil)
+}
+
+func TestNativePullConflict(t *testing.T) {
+	url := newRemote(t)
+	a, b := clone(t, url), clone(t, url)
+
+	local := commitFile(t, a, "README.md", "a")
+	commitFile(t, b, "README.md", "b")
+	push(t, b)
+
+	if err := a.Pull(context.Background()); err == nil {
+		t.Fatal("expected a conflict")
+	}
+	if got := head(t, a); got != local {
+		t.Errorf("head = %s after aborted rebase, expected %s", got, local)
+	}
+}
+
+func TestNativePullRewritten(t *testing.T) {
+	url := newRemote(t)
+	a := clone(t, url)
+	initial := head(t, a)
+
+	commitFile(t, a, "pushed", "pushed")
+	push(t, a)
+
+	b := clone(t, url)
+	rewritten := forcePush(t, b, initial, "rewritten")
+	pull(t, a)
+
+	if got := head(t, a); got != rewritten {
+		t.Errorf("head = %s, expected %s", got, rewritten)
+	}
+	assertFiles(t, a, []string{"rewritten"}, []string{"pushed"})
+}
+
+func TestNativePullRewrittenUnpushed(t *testing.T) {
+	url := newRemote(t)
+	a := clone(t, url)
+	initial := head(t, a)
+
+	commitFile(t, a, "pushed", "pushed")
+	push(t, a)
+	commitFile(t, a, "unpushed", "unpushed")
+
+	b := clone(t, url)
+	rewritten := forcePush(t, b, initial, "rewritten")
+	pull(t, a)
+
+	if got := parent(t, a); got != rewritten {
+		t.Errorf("unpushed commit rebased onto %s, expected %s", got, rewritten)
+	}
+	assertFiles(t, a, []string{"rewritten", "unpushed"}, []string{"pushed"})
+}
+
+func TestNativePushRejected(t *testing.T) {
+	url := newRemote(t)
+	a, b := clone(t, url), clone(t, url)
+
+	commitFile(t, a, "a", "a")
+	pushed := commitFile(t, b, "b", "b")
+	push(t, b)
+
+	ctx := context.Background()
+	if err := a.Push(ctx); err == nil {
+		t.Fatal("expected the push to be rejected")
+	}
+
+	if err := a.Fetch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := head(t, a); got != pushed {
+		t.Errorf("head = %s after reset, expected %s", got, pushed)
+	}
+	assertFiles(t, a, []string{"b"}, []string{"a"})
+}
+
+func TestNativeAuthorFromConfig(t *testing.T) {
+	n := clone(t, newRemote(t))
+
+	cfg, err := n.repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.User.Name = "Jane Doe"
+	cfg.User.Email = "jane@example.com"
+	if err := n.repo.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := n.repo.CommitObject(plumbing.NewHash(commitFile(t, n, "a", "a")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Author.Name != "Jane Doe" || c.Author.Email != "jane@example.com" {
+		t.Errorf("author = %s <%s>, expected Jane Doe <jane@example.com>", c.Author.Name, c.Author.Email)
+	}
+}
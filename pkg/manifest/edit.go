@@ -0,0 +1,542 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// editDocument changes the YAML document body to value with the smallest possible text edit
+// so that comments, blank lines, key order and quoting of the unchanged fields are kept.
+// Parts that can not be edited in place, such as flow style collections or block scalars,
+// are written again as a whole. If the document can not be edited at all it is marshalled
+// again.
+func editDocument(body string, value interface{}) (string, error) {
+	newValue, err := toGeneric(value)
+	if err != nil {
+		return "", err
+	}
+
+	if result, ok := tryEdit(body, newValue); ok {
+		return result, nil
+	}
+
+	data, err := sigsyaml.Marshal(newValue)
+	return string(data), err
+}
+
+func toGeneric(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	return result, utiljson.Unmarshal(data, &result)
+}
+
+func tryEdit(body string, value interface{}) (string, bool) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal([]byte(body), doc); err != nil ||
+		doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 {
+		return "", false
+	}
+
+	e := newEditor(body)
+	edits, ok := e.merge(doc.Content[0], value, e.trimEnd(len(e.lines), 1, 1))
+	if !ok {
+		return "", false
+	}
+
+	// an alias to an anchor that was written again would now point to nothing or the new value
+	result := e.apply(edits)
+	if decoded, err := decode(result); err != nil || !reflect.DeepEqual(interface{}(decoded), value) {
+		return "", false
+	}
+	return result, true
+}
+
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+type editor struct {
+	body    string
+	lines   []string
+	offsets []int
+	indent  int
+	compact bool
+}
+
+func newEditor(body string) *editor {
+	e := &editor{
+		body:    body,
+		indent:  2,
+		compact: true,
+	}
+
+	offset := 0
+	for _, line := range strings.SplitAfter(body, "\n") {
+		if line == "" {
+			continue
+		}
+		e.lines = append(e.lines, strings.TrimRight(line, "\r\n"))
+		e.offsets = append(e.offsets, offset)
+		offset += len(line)
+	}
+
+	e.detectStyle()
+	return e
+}
+
+// detectStyle finds the indentation and the sequence style used in the document so that
+// new fields are written the same way
+func (e *editor) detectStyle() {
+	foundIndent, foundSeq := false, false
+	for i, line := range e.lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasSuffix(trimmed, ":") || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		next := e.nextContentLine(i + 1)
+		if next < 0 {
+			continue
+		}
+		nextLine := e.lines[next]
+		nextTrimmed := strings.TrimSpace(nextLine)
+		diff := indentation(nextLine) - indentation(line)
+		if strings.HasPrefix(line[indentation(line):], "- ") {
+			// the key is after the dash of a sequence item
+			diff -= 2
+		}
+
+		if strings.HasPrefix(nextTrimmed, "- ") || nextTrimmed == "-" {
+			if !foundSeq {
+				foundSeq = true
+				e.compact = diff == 0
+			}
+		} else if !foundIndent && diff > 0 {
+			foundIndent = true
+			e.indent = diff
+		}
+		if foundIndent && foundSeq {
+			return
+		}
+	}
+}
+
+func (e *editor) nextContentLine(i int) int {
+	for ; i < len(e.lines); i++ {
+		trimmed := strings.TrimSpace(e.lines[i])
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return i
+		}
+	}
+	return -1
+}
+
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// lineStart returns the offset of the 1 based line, or the end of the body
+func (e *editor) lineStart(line int) int {
+	if line-1 < len(e.offsets) {
+		return e.offsets[line-1]
+	}
+	return len(e.body)
+}
+
+// pos returns the offset of the 1 based line and column
+func (e *editor) pos(line, column int) int {
+	if line-1 >= len(e.lines) {
+		return len(e.body)
+	}
+	runes := []rune(e.lines[line-1])
+	if column-1 > len(runes) {
+		column = len(runes) + 1
+	}
+	return e.offsets[line-1] + len(string(runes[:column-1]))
+}
+
+// trimEnd moves the last line of a node starting at line and column up past blank lines
+// and comments that are not indented more than the node, they belong to what follows
+func (e *editor) trimEnd(last, line, column int) int {
+	for last > line {
+		text := e.lines[last-1]
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || (strings.HasPrefix(trimmed, "#") && indentation(text) <= column-1) {
+			last--
+			continue
+		}
+		break
+	}
+	return last
+}
+
+func commentLines(node *yaml.Node) int {
+	if node.HeadComment == "" {
+		return 0
+	}
+	return strings.Count(node.HeadComment, "\n") + 1
+}
+
+func (e *editor) apply(edits []textEdit) string {
+	// edits of nested nodes come first, they have to end up before an insert of the parent
+	// at the same offset
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	result := e.body
+	for _, change := range edits {
+		result = result[:change.start] + change.text + result[change.end:]
+	}
+	return result
+}
+
+func equal(node *yaml.Node, value interface{}) bool {
+	var decoded interface{}
+	if err := node.Decode(&decoded); err != nil {
+		return false
+	}
+	decoded, err := toGeneric(decoded)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(decoded, value)
+}
+
+// merge returns the edits that change node to value. The node ends at the 1 based line end.
+// If the node can not be changed in place false is returned and the caller has to write
+// the node again.
+func (e *editor) merge(node *yaml.Node, value interface{}, end int) ([]textEdit, bool) {
+	if equal(node, value) {
+		return nil, true
+	}
+	if node.Kind == yaml.AliasNode || node.Anchor != "" || node.Style&yaml.FlowStyle != 0 {
+		return nil, false
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		newMap, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		return e.mergeMapping(node, newMap, end)
+	case yaml.SequenceNode:
+		newSlice, ok := value.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		return e.mergeSequence(node, newSlice, end)
+	case yaml.ScalarNode:
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, false
+		}
+		return e.replaceScalar(node, value)
+	}
+	return nil, false
+}
+
+func (e *editor) mergeMapping(node *yaml.Node, value map[string]interface{}, end int) ([]textEdit, bool) {
+	if len(node.Content) == 0 || len(value) == 0 {
+		return nil, false
+	}
+
+	var (
+		edits    []textEdit
+		seen     = map[string]bool{}
+		entryEnd int
+	)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, val := node.Content[i], node.Content[i+1]
+		next := end
+		if i+2 < len(node.Content) {
+			nextKey := node.Content[i+2]
+			next = nextKey.Line - commentLines(nextKey) - 1
+		}
+		entryEnd = e.trimEnd(next, key.Line, key.Column)
+
+		seen[key.Value] = true
+		newVal, ok := value[key.Value]
+		if !ok {
+			if e.afterDash(key) {
+				// removing the first field of a sequence item moves the next one up
+				return nil, false
+			}
+			edits = append(edits, textEdit{
+				start: e.lineStart(key.Line - commentLines(key)),
+				end:   e.lineStart(entryEnd + 1),
+			})
+			continue
+		}
+
+		valueEdits, ok := e.merge(val, newVal, entryEnd)
+		if !ok {
+			replace, ok := e.replaceEntry(key, newVal, entryEnd)
+			if !ok {
+				return nil, false
+			}
+			valueEdits = []textEdit{replace}
+		}
+		edits = append(edits, valueEdits...)
+	}
+
+	added := map[string]interface{}{}
+	for k, v := range value {
+		if !seen[k] {
+			added[k] = v
+		}
+	}
+	if len(added) > 0 {
+		text, ok := e.render(added, node.Content[0].Column-1, true)
+		if !ok {
+			return nil, false
+		}
+		start := e.lineStart(entryEnd + 1)
+		if start == len(e.body) && !strings.HasSuffix(e.body, "\n") {
+			text = "\n" + text
+		}
+		edits = append(edits, textEdit{
+			start: start,
+			end:   start,
+			text:  text,
+		})
+	}
+
+	return edits, true
+}
+
+// afterDash returns true if node is on the same line after the dash of a sequence item
+func (e *editor) afterDash(node *yaml.Node) bool {
+	line := e.lines[node.Line-1]
+	return node.Column-1 > indentation(line)
+}
+
+// dashIndent returns the indentation of the dashes of the items of a block sequence
+func (e *editor) dashIndent(node *yaml.Node) (int, bool) {
+	first := node.Content[0]
+	indent := first.Column - 3
+	line := e.lines[first.Line-1]
+	if indent < 0 || !strings.HasPrefix(line[indent:], "- ") {
+		return 0, false
+	}
+	return indent, true
+}
+
+func (e *editor) mergeSequence(node *yaml.Node, value []interface{}, end int) ([]textEdit, bool) {
+	items := node.Content
+	if len(items) == 0 {
+		return nil, false
+	}
+	dashIndent, ok := e.dashIndent(node)
+	if !ok {
+		return nil, false
+	}
+
+	itemEnd := func(i int) int {
+		if i+1 < len(items) {
+			return e.trimEnd(items[i+1].Line-commentLines(items[i+1])-1, items[i].Line, dashIndent+1)
+		}
+		return e.trimEnd(end, items[i].Line, dashIndent+1)
+	}
+
+	switch {
+	case len(value) == len(items):
+		var edits []textEdit
+		for i, item := range items {
+			itemEdits, ok := e.merge(item, value[i], itemEnd(i))
+			if !ok {
+				text, ok := e.render(value[i], item.Column-1, false)
+				if !ok {
+					return nil, false
+				}
+				itemEdits = []textEdit{{
+					start: e.pos(item.Line, item.Column),
+					end:   e.lineStart(itemEnd(i) + 1),
+					text:  text,
+				}}
+			}
+			edits = append(edits, itemEdits...)
+		}
+		return edits, true
+	case len(value) > len(items):
+		for i, item := range items {
+			if !equal(item, value[i]) {
+				return nil, false
+			}
+		}
+		text, ok := e.render(value[len(items):], dashIndent, true)
+		if !ok {
+			return nil, false
+		}
+		start := e.lineStart(itemEnd(len(items)-1) + 1)
+		if start == len(e.body) && !strings.HasSuffix(e.body, "\n") {
+			text = "\n" + text
+		}
+		return []textEdit{{
+			start: start,
+			end:   start,
+			text:  text,
+		}}, true
+	case len(value) == len(items)-1:
+		removed := len(value)
+		for i := range value {
+			if !equal(items[i], value[i]) {
+				removed = i
+				break
+			}
+		}
+		for i := removed; i < len(value); i++ {
+			if !equal(items[i+1], value[i]) {
+				return nil, false
+			}
+		}
+		if e.afterDash(node.Content[removed]) && e.lines[items[removed].Line-1][dashIndent] != '-' {
+			return nil, false
+		}
+		return []textEdit{{
+			start: e.lineStart(items[removed].Line - commentLines(items[removed])),
+			end:   e.lineStart(itemEnd(removed) + 1),
+		}}, true
+	}
+
+	return nil, false
+}
+
+// replaceEntry writes the entry of key again with value, keeping what is before the key on
+// its line
+func (e *editor) replaceEntry(key *yaml.Node, value interface{}, end int) (textEdit, bool) {
+	if key.Kind != yaml.ScalarNode {
+		return textEdit{}, false
+	}
+	text, ok := e.render(map[string]interface{}{
+		key.Value: value,
+	}, key.Column-1, false)
+	if !ok {
+		return textEdit{}, false
+	}
+	return textEdit{
+		start: e.pos(key.Line, key.Column),
+		end:   e.lineStart(end + 1),
+		text:  text,
+	}, true
+}
+
+func (e *editor) replaceScalar(node *yaml.Node, value interface{}) ([]textEdit, bool) {
+	if node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		return nil, false
+	}
+
+	line := e.lines[node.Line-1]
+	start := len(string([]rune(line)[:node.Column-1]))
+	token, ok := scalarToken(line[start:], node.Style)
+	if !ok || token == "" {
+		return nil, false
+	}
+
+	// a scalar that continues on the next lines is not only this token
+	var tokenValue yaml.Node
+	if err := yaml.Unmarshal([]byte(token), &tokenValue); err != nil ||
+		len(tokenValue.Content) != 1 || tokenValue.Content[0].Value != node.Value {
+		return nil, false
+	}
+
+	newNode := &yaml.Node{}
+	if err := newNode.Encode(value); err != nil {
+		return nil, false
+	}
+	if _, isString := value.(string); isString && newNode.Style == 0 &&
+		node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) != 0 {
+		newNode.Style = node.Style & (yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle)
+	}
+	data, err := yaml.Marshal(newNode)
+	if err != nil {
+		return nil, false
+	}
+	text := strings.TrimSuffix(string(data), "\n")
+	if strings.Contains(text, "\n") {
+		return nil, false
+	}
+
+	offset := e.offsets[node.Line-1] + start
+	return []textEdit{{
+		start: offset,
+		end:   offset + len(token),
+		text:  text,
+	}}, true
+}
+
+// scalarToken returns the source of the scalar at the start of s
+func scalarToken(s string, style yaml.Style) (string, bool) {
+	switch {
+	case style&yaml.DoubleQuotedStyle != 0:
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				return s[:i+1], true
+			}
+		}
+		return "", false
+	case style&yaml.SingleQuotedStyle != 0:
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i++
+					continue
+				}
+				return s[:i+1], true
+			}
+		}
+		return "", false
+	}
+
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimRight(s, " \t"), true
+}
+
+// render marshals value in the style of the document. Every line but the first is indented,
+// the first one too if indentFirst is set.
+func (e *editor) render(value interface{}, indent int, indentFirst bool) (string, bool) {
+	buf := &bytes.Buffer{}
+	enc := yaml.NewEncoder(buf)
+	enc.SetIndent(e.indent)
+	if e.compact {
+		enc.CompactSeqIndent()
+	}
+	if err := enc.Encode(value); err != nil {
+		return "", false
+	}
+	if err := enc.Close(); err != nil {
+		return "", false
+	}
+
+	prefix := strings.Repeat(" ", indent)
+	lines := strings.SplitAfter(buf.String(), "\n")
+	result := &strings.Builder{}
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		if (i > 0 || indentFirst) && line != "\n" {
+			result.WriteString(prefix)
+		}
+		result.WriteString(line)
+	}
+	return result.String(), true
+}
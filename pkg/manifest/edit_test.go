@@ -0,0 +1,453 @@
+package manifest
+
+import (
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func fromYAML(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+
+	obj := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(data), &obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func TestUpdateYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		match    string
+		obj      string
+		expected string
+	}{
+		{
+			name: "comments",
+			data: `# head comment
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data:
+  # line comment
+  k: v # trailing
+  z: old
+
+# foot comment
+`,
+			match: "a",
+			obj:   `{apiVersion: v1, kind: ConfigMap, metadata: {name: a}, data: {k: v, z: new}}`,
+			expected: `# head comment
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data:
+  # line comment
+  k: v # trailing
+  z: new
+
+# foot comment
+`,
+		},
+		{
+			name: "quoting",
+			data: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data:
+  single: 'a'
+  double: "b"
+  plain: c
+`,
+			match: "a",
+			obj:   `{apiVersion: v1, kind: ConfigMap, metadata: {name: a}, data: {single: x, double: "y", plain: "true"}}`,
+			expected: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data:
+  single: 'x'
+  double: "y"
+  plain: "true"
+`,
+		},
+		{
+			name: "added keys",
+			data: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data:
+  z: "1"
+  a: "2"
+`,
+			match: "a",
+			obj:   `{apiVersion: v1, kind: ConfigMap, metadata: {name: a, labels: {x: "y"}}, data: {z: "1", a: "2", m: "3"}}`,
+			expected: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+  labels:
+    x: "y"
+data:
+  z: "1"
+  a: "2"
+  m: "3"
+`,
+		},
+		{
+			name: "removed keys",
+			data: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data:
+  z: "1"
+  # about m
+  m: x
+  a: "2"
+`,
+			match: "a",
+			obj:   `{apiVersion: v1, kind: ConfigMap, metadata: {name: a}, data: {z: "1", a: "2"}}`,
+			expected: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data:
+  z: "1"
+  a: "2"
+`,
+		},
+		{
+			name: "sequences",
+			data: `kind: X
+metadata:
+  name: a
+spec:
+  list:
+  - one
+  - two # second
+  items:
+    - name: a
+      v: 1
+    - name: b
+      v: 2
+`,
+			match: "a",
+			obj:   `{kind: X, metadata: {name: a}, spec: {list: [one, two, three], items: [{name: a, v: 1}, {name: b, v: 3}]}}`,
+			expected: `kind: X
+metadata:
+  name: a
+spec:
+  list:
+  - one
+  - two # second
+  - three
+  items:
+    - name: a
+      v: 1
+    - name: b
+      v: 3
+`,
+		},
+		{
+			name: "removed sequence item",
+			data: `kind: X
+metadata:
+  name: a
+spec:
+  list:
+  - one
+  - two # second
+  - three
+`,
+			match: "a",
+			obj:   `{kind: X, metadata: {name: a}, spec: {list: [one, three]}}`,
+			expected: `kind: X
+metadata:
+  name: a
+spec:
+  list:
+  - one
+  - three
+`,
+		},
+		{
+			name: "unchanged block scalar",
+			data: `kind: X
+metadata:
+  name: a
+spec:
+  script: |
+    echo one
+    echo two
+  other: a
+`,
+			match: "a",
+			obj:   `{kind: X, metadata: {name: a}, spec: {script: "echo one\necho two\n", other: b}}`,
+			expected: `kind: X
+metadata:
+  name: a
+spec:
+  script: |
+    echo one
+    echo two
+  other: b
+`,
+		},
+		{
+			name: "changed block scalar",
+			data: `kind: X
+metadata:
+  name: a
+spec:
+  script: >
+    echo one
+  other: a
+`,
+			match: "a",
+			obj:   `{kind: X, metadata: {name: a}, spec: {script: "echo two\necho three\n", other: a}}`,
+			expected: `kind: X
+metadata:
+  name: a
+spec:
+  script: |
+    echo two
+    echo three
+  other: a
+`,
+		},
+		{
+			name: "flow style",
+			data: `kind: X
+metadata: {name: a}
+spec:
+  flow: {a: 1, b: 2}
+`,
+			match: "a",
+			obj:   `{kind: X, metadata: {name: a}, spec: {flow: {a: 1, b: 3}}}`,
+			expected: `kind: X
+metadata: {name: a}
+spec:
+  flow:
+    a: 1
+    b: 3
+`,
+		},
+		{
+			name: "unchanged anchor",
+			data: `kind: X
+metadata:
+  name: a
+spec:
+  base: &base
+    a: 1
+  copy: *base
+  other: a
+`,
+			match: "a",
+			obj:   `{kind: X, metadata: {name: a}, spec: {base: {a: 1}, copy: {a: 1}, other: b}}`,
+			expected: `kind: X
+metadata:
+  name: a
+spec:
+  base: &base
+    a: 1
+  copy: *base
+  other: b
+`,
+		},
+		{
+			name: "changed anchor",
+			data: `kind: X
+metadata:
+  name: a
+spec:
+  base: &base
+    a: 1
+  copy: *base
+`,
+			match: "a",
+			obj:   `{kind: X, metadata: {name: a}, spec: {base: {a: 2}, copy: {a: 1}}}`,
+			expected: `kind: X
+metadata:
+  name: a
+spec:
+  base:
+    a: 2
+  copy:
+    a: 1
+`,
+		},
+		{
+			name: "multiple documents",
+			data: `# first
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data: {k: v} # flow
+--- # second
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+data:
+  k: v # unchanged
+---
+# third
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: c
+data:
+  'k':   "v"
+`,
+			match: "b",
+			obj:   `{apiVersion: v1, kind: ConfigMap, metadata: {name: b}, data: {k: changed}}`,
+			expected: `# first
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: a
+data: {k: v} # flow
+--- # second
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: b
+data:
+  k: changed # unchanged
+---
+# third
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: c
+data:
+  'k':   "v"
+`,
+		},
+		{
+			name: "list item",
+			data: `apiVersion: v1
+kind: List
+items:
+# first item
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: a
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: b
+`,
+			match: "b",
+			obj:   `{apiVersion: v1, kind: ConfigMap, metadata: {name: b}, data: {k: v}}`,
+			expected: `apiVersion: v1
+kind: List
+items:
+# first item
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: a
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: b
+  data:
+    k: v
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Update(FormatYAML, []byte(tt.data), matchName(tt.match), fromYAML(t, tt.obj))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("got:\n%s\nexpected:\n%s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAppendYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{
+			name: "document",
+			data: "# comment\nkind: ConfigMap\nmetadata:\n  name: a",
+			expected: "# comment\nkind: ConfigMap\nmetadata:\n  name: a\n---\n" +
+				"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: new\n",
+		},
+		{
+			name:     "trailing separator",
+			data:     "kind: ConfigMap\nmetadata:\n  name: a\n---\n",
+			expected: "kind: ConfigMap\nmetadata:\n  name: a\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: new\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Append(FormatYAML, []byte(tt.data), configMap("new", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("got:\n%s\nexpected:\n%s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDeleteYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		match    string
+		expected string
+	}{
+		{
+			name:     "document",
+			data:     "# first\nkind: ConfigMap\nmetadata:\n  name: a\n--- # second\nkind: ConfigMap\nmetadata:\n  name: b\n",
+			match:    "a",
+			expected: "kind: ConfigMap\nmetadata:\n  name: b\n",
+		},
+		{
+			name:     "list item",
+			data:     "kind: List\nitems:\n- kind: ConfigMap\n  metadata:\n    name: a\n- kind: ConfigMap # b\n  metadata:\n    name: b\n",
+			match:    "a",
+			expected: "kind: List\nitems:\n- kind: ConfigMap # b\n  metadata:\n    name: b\n",
+		},
+		{
+			name:  "last document",
+			data:  "# comment\nkind: ConfigMap\nmetadata:\n  name: a\n",
+			match: "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Delete(FormatYAML, []byte(tt.data), matchName(tt.match))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("got:\n%s\nexpected:\n%s", result, tt.expected)
+			}
+		})
+	}
+}
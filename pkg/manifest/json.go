@@ -0,0 +1,388 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+)
+
+const defaultIndent = "  "
+
+func decodeJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	// numbers are decoded as int64 where possible, like the YAML decoder does
+	if err := utiljson.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func marshalJSON(v interface{}, indent string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// indentOf returns the indentation used in data so that it is kept when the file is written
+// again, "" if data is on one line
+func indentOf(data []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) < 2 {
+		return ""
+	}
+	line := lines[1]
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+func parseJSON(data []byte) ([]Document, error) {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return documents(0, t)
+	case []interface{}:
+		var result []Document
+		for i, elem := range t {
+			obj, ok := elem.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			docs, err := documents(i, obj)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, docs...)
+		}
+		return result, nil
+	}
+	return nil, nil
+}
+
+// span is the byte range of a JSON value in a file
+type span struct {
+	start, end int
+}
+
+// location is where the object selected by a Match is in a file
+type location struct {
+	value span
+	// elements are the spans of the array the object is in, nil if the file is the object
+	elements []span
+	index    int
+}
+
+// skipSeparators returns the offset of the first byte of data[offset:] that is not
+// whitespace, a comma or a colon
+func skipSeparators(data []byte, offset int) int {
+	for offset < len(data) && strings.IndexByte(" \t\r\n,:", data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// rootSpan returns the span of the value in data
+func rootSpan(data []byte) (span, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	var raw json.RawMessage
+	if err := dec.Decode(&raw); err != nil {
+		return span{}, err
+	}
+	return span{
+		start: skipSeparators(data, 0),
+		end:   int(dec.InputOffset()),
+	}, nil
+}
+
+// elementSpans returns the spans of the elements of the array at s
+func elementSpans(data []byte, s span) ([]span, error) {
+	dec := json.NewDecoder(bytes.NewReader(data[s.start:s.end]))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+
+	var result []span
+	for dec.More() {
+		offset := int(dec.InputOffset())
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		result = append(result, span{
+			start: skipSeparators(data, s.start+offset),
+			end:   s.start + int(dec.InputOffset()),
+		})
+	}
+	return result, nil
+}
+
+// fieldSpan returns the span of the value of key in the object at s
+func fieldSpan(data []byte, s span, key string) (span, error) {
+	dec := json.NewDecoder(bytes.NewReader(data[s.start:s.end]))
+	if _, err := dec.Token(); err != nil {
+		return span{}, err
+	}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return span{}, err
+		}
+		offset := int(dec.InputOffset())
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return span{}, err
+		}
+		if token == key {
+			return span{
+				start: skipSeparators(data, s.start+offset),
+				end:   s.start + int(dec.InputOffset()),
+			}, nil
+		}
+	}
+	return span{}, fmt.Errorf("%s not found", key)
+}
+
+// locate finds the object selected by match in data, v is the decoded content of data
+func locate(data []byte, v interface{}, match Match) (location, error) {
+	root, err := rootSpan(data)
+	if err != nil {
+		return location{}, err
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if isList(t) {
+			return locateItem(data, root, t, match)
+		} else if match(t) {
+			return location{value: root}, nil
+		}
+	case []interface{}:
+		elements, err := elementSpans(data, root)
+		if err != nil {
+			return location{}, err
+		}
+		for i, elem := range t {
+			elemObj, ok := elem.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if isList(elemObj) {
+				loc, err := locateItem(data, elements[i], elemObj, match)
+				if err == ErrNotFound {
+					continue
+				}
+				return loc, err
+			} else if match(elemObj) {
+				return location{value: elements[i], elements: elements, index: i}, nil
+			}
+		}
+	}
+	return location{}, ErrNotFound
+}
+
+// locateItem finds the object selected by match in the items of the List at s
+func locateItem(data []byte, s span, list map[string]interface{}, match Match) (location, error) {
+	items, _ := list["items"].([]interface{})
+	for i, item := range items {
+		if itemObj, ok := item.(map[string]interface{}); !ok || !match(itemObj) {
+			continue
+		}
+		itemsSpan, err := fieldSpan(data, s, "items")
+		if err != nil {
+			return location{}, err
+		}
+		elements, err := elementSpans(data, itemsSpan)
+		if err != nil {
+			return location{}, err
+		}
+		return location{value: elements[i], elements: elements, index: i}, nil
+	}
+	return location{}, ErrNotFound
+}
+
+// lineIndent returns the whitespace at the start of the line offset is in
+func lineIndent(data []byte, offset int) string {
+	start := bytes.LastIndexByte(data[:offset], '\n') + 1
+	line := data[start:offset]
+	return string(line[:len(line)-len(bytes.TrimLeft(line, " \t"))])
+}
+
+// marshalAt marshals v to replace the value at s. Values that were on one line are written
+// on one line, others are indented like the rest of the file.
+func marshalAt(data []byte, s span, v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if indent := indentOf(data); indent != "" && bytes.IndexByte(data[s.start:s.end], '\n') >= 0 {
+		enc.SetIndent(lineIndent(data, s.start), indent)
+	}
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func splice(data []byte, s span, value []byte) []byte {
+	result := make([]byte, 0, len(data)-(s.end-s.start)+len(value))
+	result = append(result, data[:s.start]...)
+	result = append(result, value...)
+	return append(result, data[s.end:]...)
+}
+
+// updateJSON replaces only the bytes of the object, the rest of the file is left as it is
+func updateJSON(data []byte, match Match, obj interface{}) ([]byte, error) {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := locate(data, v, match)
+	if err != nil {
+		return nil, err
+	}
+	value, err := marshalAt(data, loc.value, obj)
+	if err != nil {
+		return nil, err
+	}
+	return splice(data, loc.value, value), nil
+}
+
+// appendTarget returns the span of the array that an object can be appended to, which
+// requires an array or a List
+func appendTarget(data []byte) (span, error) {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return span{}, err
+	}
+	root, err := rootSpan(data)
+	if err != nil {
+		return span{}, err
+	}
+
+	switch t := v.(type) {
+	case []interface{}:
+		return root, nil
+	case map[string]interface{}:
+		if isList(t) {
+			return fieldSpan(data, root, "items")
+		}
+	}
+	return span{}, fmt.Errorf("the file has a single object, objects can only be added to JSON files with an array or a List")
+}
+
+// appendJSON adds obj after the last element of the array or List, formatted like it
+func appendJSON(data []byte, obj interface{}) ([]byte, error) {
+	target, err := appendTarget(data)
+	if err != nil {
+		return nil, err
+	}
+	elements, err := elementSpans(data, target)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(elements) == 0 {
+		value, err := marshalAt(data, target, []interface{}{obj})
+		if err != nil {
+			return nil, err
+		}
+		return splice(data, target, value), nil
+	}
+
+	last := elements[len(elements)-1]
+	value, err := marshalAt(data, last, obj)
+	if err != nil {
+		return nil, err
+	}
+	separator := ", "
+	if bytes.IndexByte(data[target.start:target.end], '\n') >= 0 {
+		separator = ",\n" + lineIndent(data, last.start)
+	}
+	return splice(data, span{start: last.end, end: last.end}, append([]byte(separator), value...)), nil
+}
+
+// removeItem removes the object selected by match from the items of list, returning false
+// if it is not in the list
+func removeItem(list map[string]interface{}, match Match) bool {
+	items, _ := list["items"].([]interface{})
+	for i, item := range items {
+		if itemObj, ok := item.(map[string]interface{}); ok && match(itemObj) {
+			list["items"] = append(items[:i:i], items[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// deleteJSON removes only the bytes of the object if other objects are left in its array.
+// Otherwise the file is removed if no objects are left in it or written again.
+func deleteJSON(data []byte, match Match) ([]byte, error) {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	loc, err := locate(data, v, match)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(loc.elements) > 1 && loc.index > 0:
+		// from the end of the previous element, including the comma
+		return splice(data, span{start: loc.elements[loc.index-1].end, end: loc.value.end}, nil), nil
+	case len(loc.elements) > 1:
+		return splice(data, span{start: loc.value.start, end: loc.elements[1].start}, nil), nil
+	}
+
+	found := false
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if isList(t) {
+			found = removeItem(t, match)
+			if found && len(t["items"].([]interface{})) == 0 {
+				return nil, nil
+			}
+		} else if match(t) {
+			return nil, nil
+		}
+	case []interface{}:
+		for i, elem := range t {
+			elemObj, ok := elem.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if isList(elemObj) {
+				found = removeItem(elemObj, match)
+				if found && len(elemObj["items"].([]interface{})) == 0 {
+					t = append(t[:i:i], t[i+1:]...)
+				}
+			} else if match(elemObj) {
+				found = true
+				t = append(t[:i:i], t[i+1:]...)
+			}
+			if found {
+				break
+			}
+		}
+		if len(t) == 0 {
+			return nil, nil
+		}
+		v = t
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	return marshalJSON(v, indentOf(data))
+}
@@ -0,0 +1,263 @@
+package manifest
+
+import (
+	"testing"
+)
+
+func configMap(name string, data map[string]interface{}) map[string]interface{} {
+	obj := map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata": map[string]interface{}{
+			"name": name,
+		},
+	}
+	if data != nil {
+		obj["data"] = data
+	}
+	return obj
+}
+
+func matchName(name string) Match {
+	return func(obj map[string]interface{}) bool {
+		metadata, _ := obj["metadata"].(map[string]interface{})
+		return metadata["name"] == name
+	}
+}
+
+const jsonArray = `[
+    {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a"}},
+    {
+        "apiVersion": "v1",
+        "kind": "ConfigMap",
+        "metadata": {
+            "name": "b"
+        }
+    },
+    {
+        "apiVersion": "v1",
+        "kind": "List",
+        "items": [
+            {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "c"}},
+            {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "d"}}
+        ]
+    }
+]
+`
+
+func TestUpdateJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		match    string
+		obj      map[string]interface{}
+		expected string
+	}{
+		{
+			name:  "single object",
+			data:  "{\n\t\"apiVersion\": \"v1\",\n\t\"kind\": \"ConfigMap\",\n\t\"metadata\": {\"name\": \"a\"}\n}\n",
+			match: "a",
+			obj:   configMap("a", map[string]interface{}{"k": "v"}),
+			expected: "{\n\t\"apiVersion\": \"v1\",\n\t\"data\": {\n\t\t\"k\": \"v\"\n\t},\n\t\"kind\": \"ConfigMap\",\n" +
+				"\t\"metadata\": {\n\t\t\"name\": \"a\"\n\t}\n}\n",
+		},
+		{
+			name:     "single line object",
+			data:     `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a"}}` + "\n",
+			match:    "a",
+			obj:      configMap("a", map[string]interface{}{"url": "a<b>"}),
+			expected: `{"apiVersion":"v1","data":{"url":"a<b>"},"kind":"ConfigMap","metadata":{"name":"a"}}` + "\n",
+		},
+		{
+			name:  "single line element",
+			data:  jsonArray,
+			match: "a",
+			obj:   configMap("a", map[string]interface{}{"k": "v"}),
+			expected: `[
+    {"apiVersion":"v1","data":{"k":"v"},"kind":"ConfigMap","metadata":{"name":"a"}},
+    {
+        "apiVersion": "v1",
+        "kind": "ConfigMap",
+        "metadata": {
+            "name": "b"
+        }
+    },
+    {
+        "apiVersion": "v1",
+        "kind": "List",
+        "items": [
+            {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "c"}},
+            {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "d"}}
+        ]
+    }
+]
+`,
+		},
+		{
+			name:  "indented element",
+			data:  jsonArray,
+			match: "b",
+			obj:   configMap("b", map[string]interface{}{"k": "v"}),
+			expected: `[
+    {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a"}},
+    {
+        "apiVersion": "v1",
+        "data": {
+            "k": "v"
+        },
+        "kind": "ConfigMap",
+        "metadata": {
+            "name": "b"
+        }
+    },
+    {
+        "apiVersion": "v1",
+        "kind": "List",
+        "items": [
+            {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "c"}},
+            {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "d"}}
+        ]
+    }
+]
+`,
+		},
+		{
+			name:  "list item",
+			data:  jsonArray,
+			match: "d",
+			obj:   configMap("d", map[string]interface{}{"k": "v"}),
+			expected: `[
+    {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a"}},
+    {
+        "apiVersion": "v1",
+        "kind": "ConfigMap",
+        "metadata": {
+            "name": "b"
+        }
+    },
+    {
+        "apiVersion": "v1",
+        "kind": "List",
+        "items": [
+            {"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "c"}},
+            {"apiVersion":"v1","data":{"k":"v"},"kind":"ConfigMap","metadata":{"name":"d"}}
+        ]
+    }
+]
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Update(FormatJSON, []byte(tt.data), matchName(tt.match), tt.obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("got:\n%s\nexpected:\n%s", result, tt.expected)
+			}
+		})
+	}
+
+	if _, err := Update(FormatJSON, []byte(jsonArray), matchName("missing"), configMap("missing", nil)); err != ErrNotFound {
+		t.Errorf("updating a missing object returned %v, expected %v", err, ErrNotFound)
+	}
+}
+
+func TestAppendJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected string
+		err      bool
+	}{
+		{
+			name: "array",
+			data: "[\n  {\n    \"kind\": \"ConfigMap\"\n  }\n]\n",
+			expected: "[\n  {\n    \"kind\": \"ConfigMap\"\n  },\n  {\n    \"apiVersion\": \"v1\",\n" +
+				"    \"kind\": \"ConfigMap\",\n    \"metadata\": {\n      \"name\": \"new\"\n    }\n  }\n]\n",
+		},
+		{
+			name:     "single line array",
+			data:     `[{"kind": "ConfigMap"}]`,
+			expected: `[{"kind": "ConfigMap"}, {"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"new"}}]`,
+		},
+		{
+			name:     "empty list",
+			data:     `{"apiVersion": "v1", "kind": "List", "items": []}`,
+			expected: `{"apiVersion": "v1", "kind": "List", "items": [{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"new"}}]}`,
+		},
+		{
+			name: "single object",
+			data: `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "a"}}`,
+			err:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CanAppend(FormatJSON, []byte(tt.data)); (err != nil) != tt.err {
+				t.Fatalf("CanAppend returned %v", err)
+			}
+			result, err := Append(FormatJSON, []byte(tt.data), configMap("new", nil))
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("got:\n%s\nexpected:\n%s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDeleteJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		match    string
+		expected string
+	}{
+		{
+			name:     "first element",
+			data:     "[\n  {\"metadata\": {\"name\": \"a\"}},\n  {\"metadata\": {\"name\": \"b\"}}\n]\n",
+			match:    "a",
+			expected: "[\n  {\"metadata\": {\"name\": \"b\"}}\n]\n",
+		},
+		{
+			name:     "last element",
+			data:     "[\n  {\"metadata\": {\"name\": \"a\"}},\n  {\"metadata\": {\"name\": \"b\"}}\n]\n",
+			match:    "b",
+			expected: "[\n  {\"metadata\": {\"name\": \"a\"}}\n]\n",
+		},
+		{
+			name:     "list item",
+			data:     `{"kind": "List", "items": [{"metadata": {"name": "a"}}, {"metadata": {"name": "b"}}, {"metadata": {"name": "c"}}]}`,
+			match:    "b",
+			expected: `{"kind": "List", "items": [{"metadata": {"name": "a"}}, {"metadata": {"name": "c"}}]}`,
+		},
+		{
+			name:  "last object",
+			data:  `[{"metadata": {"name": "a"}}]`,
+			match: "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Delete(FormatJSON, []byte(tt.data), matchName(tt.match))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != tt.expected {
+				t.Errorf("got:\n%s\nexpected:\n%s", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+type Format string
+
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// ErrNotFound is returned when the object to change is not in the file
+var ErrNotFound = errors.New("object not found in file")
+
+// FormatFor returns the format of a file from its extension, false if it is not a manifest
+func FormatFor(path string) (Format, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML, true
+	case ".json":
+		return FormatJSON, true
+	}
+	return "", false
+}
+
+// Extension returns the file extension used for new files of the format
+func (f Format) Extension() string {
+	if f == FormatJSON {
+		return ".json"
+	}
+	return ".yaml"
+}
+
+// Document is an object found in a manifest file
+type Document struct {
+	// Index is the position of the YAML document or JSON array element in the file
+	Index int
+	// Item is the position in the items of a List, -1 if the document is not a List
+	Item   int
+	Object map[string]interface{}
+	// Content is the source of the object, used to detect changes
+	Content []byte
+}
+
+// Match selects the object a change applies to
+type Match func(obj map[string]interface{}) bool
+
+func isList(obj map[string]interface{}) bool {
+	kind, _ := obj["kind"].(string)
+	_, hasItems := obj["items"]
+	return hasItems && strings.HasSuffix(kind, "List")
+}
+
+// documents returns the object at index, or its items if it is a List
+func documents(index int, obj map[string]interface{}) ([]Document, error) {
+	if !isList(obj) {
+		content, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		return []Document{{
+			Index:   index,
+			Item:    -1,
+			Object:  obj,
+			Content: content,
+		}}, nil
+	}
+
+	var result []Document
+	items, _ := obj["items"].([]interface{})
+	for i, item := range items {
+		itemObj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		content, err := json.Marshal(itemObj)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, Document{
+			Index:   index,
+			Item:    i,
+			Object:  itemObj,
+			Content: content,
+		})
+	}
+	return result, nil
+}
+
+// Parse returns the objects in data. YAML files can have several documents and JSON files
+// an array of objects. The items of List objects are returned as separate objects.
+func Parse(format Format, data []byte) ([]Document, error) {
+	if format == FormatJSON {
+		return parseJSON(data)
+	}
+	return parseYAML(data)
+}
+
+// Marshal returns the content of a new file with only obj in it
+func Marshal(format Format, obj interface{}) ([]byte, error) {
+	if format == FormatJSON {
+		return marshalJSON(obj, defaultIndent)
+	}
+	return yaml.Marshal(obj)
+}
+
+// Update replaces the first object selected by match with obj. The rest of the file keeps
+// its format.
+func Update(format Format, data []byte, match Match, obj interface{}) ([]byte, error) {
+	if format == FormatJSON {
+		return updateJSON(data, match, obj)
+	}
+	return updateYAML(data, match, obj)
+}
+
+// Append adds obj to a file that already has objects in it. YAML files get a new document,
+// JSON files must have an array of objects or a List to add it to.
+func Append(format Format, data []byte, obj interface{}) ([]byte, error) {
+	if format == FormatJSON {
+		return appendJSON(data, obj)
+	}
+	return appendYAML(data, obj)
+}
+
+// CanAppend returns an error if Append can not add an object to data
+func CanAppend(format Format, data []byte) error {
+	if format == FormatJSON {
+		_, err := appendTarget(data)
+		return err
+	}
+	_, err := parseYAML(data)
+	return err
+}
+
+// Delete removes the first object selected by match. If no objects are left in the file nil
+// is returned.
+func Delete(format Format, data []byte, match Match) ([]byte, error) {
+	if format == FormatJSON {
+		return deleteJSON(data, match)
+	}
+	return deleteYAML(data, match)
+}
@@ -0,0 +1,233 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"sigs.k8s.io/yaml"
+)
+
+// section is a YAML document including the separator line before it
+type section struct {
+	separator string
+	body      string
+}
+
+func split(data []byte) []section {
+	var (
+		result  []section
+		current section
+		body    strings.Builder
+	)
+
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if isSeparator(line) {
+			current.body = body.String()
+			result = append(result, current)
+			current = section{separator: line}
+			body.Reset()
+			continue
+		}
+		body.WriteString(line)
+	}
+
+	current.body = body.String()
+	return append(result, current)
+}
+
+func isSeparator(line string) bool {
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "---") {
+		return false
+	}
+	rest := line[3:]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\t'
+}
+
+func join(sections []section) []byte {
+	buf := &bytes.Buffer{}
+	for _, s := range sections {
+		buf.WriteString(s.separator)
+		buf.WriteString(s.body)
+	}
+	return buf.Bytes()
+}
+
+func decode(body string) (map[string]interface{}, error) {
+	data, err := yaml.YAMLToJSON([]byte(body))
+	if err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	// numbers are decoded as int64 where possible, the same as objects from the apiserver
+	if err := utiljson.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		obj = map[string]interface{}{}
+	}
+	return obj, nil
+}
+
+func parseYAML(data []byte) ([]Document, error) {
+	var result []Document
+	for i, s := range split(data) {
+		obj, err := decode(s.body)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+
+		docs, err := documents(i, obj)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, docs...)
+	}
+	return result, nil
+}
+
+// updateYAML changes the document of the object in place, leaving the other documents as
+// they are. Comments and formatting of the fields that did not change are kept.
+func updateYAML(data []byte, match Match, obj interface{}) ([]byte, error) {
+	return edit(data, match, func(s *section, parsed map[string]interface{}, item int) error {
+		var newObj interface{} = obj
+		if item >= 0 {
+			items := parsed["items"].([]interface{})
+			items[item] = obj
+			newObj = parsed
+		}
+		body, err := editDocument(s.body, newObj)
+		if err != nil {
+			return err
+		}
+		s.body = body
+		return nil
+	})
+}
+
+// appendYAML adds obj as a new document at the end of data, reusing a trailing empty
+// document
+func appendYAML(data []byte, obj interface{}) ([]byte, error) {
+	if _, err := parseYAML(data); err != nil {
+		return nil, err
+	}
+	body, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := split(data)
+	last := &sections[len(sections)-1]
+	if strings.TrimSpace(last.body) == "" {
+		if len(sections) == 1 {
+			return body, nil
+		}
+		last.body = string(body)
+		return join(sections), nil
+	}
+	if !strings.HasSuffix(last.body, "\n") {
+		last.body += "\n"
+	}
+	return append(join(sections), append([]byte("---\n"), body...)...), nil
+}
+
+func deleteYAML(data []byte, match Match) ([]byte, error) {
+	var deleted bool
+	result, err := edit(data, match, func(s *section, parsed map[string]interface{}, item int) error {
+		if item >= 0 {
+			items := parsed["items"].([]interface{})
+			parsed["items"] = append(items[:item:item], items[item+1:]...)
+			if len(parsed["items"].([]interface{})) > 0 {
+				body, err := editDocument(s.body, parsed)
+				if err != nil {
+					return err
+				}
+				s.body = body
+				return nil
+			}
+		}
+		deleted = true
+		s.body = ""
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if deleted {
+		result, err = removeEmpty(result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// removeEmpty drops documents without content, returning nil if there are none left
+func removeEmpty(data []byte) ([]byte, error) {
+	var (
+		result  []section
+		objects int
+	)
+	for _, s := range split(data) {
+		obj, err := decode(s.body)
+		if err != nil {
+			return nil, err
+		}
+		if len(obj) == 0 && strings.TrimSpace(s.body) == "" {
+			continue
+		}
+		if len(obj) > 0 {
+			objects++
+		}
+		if len(result) == 0 {
+			// the first document does not need a separator
+			s.separator = ""
+		}
+		result = append(result, s)
+	}
+	if objects == 0 {
+		return nil, nil
+	}
+	return join(result), nil
+}
+
+func edit(data []byte, match Match, change func(s *section, parsed map[string]interface{}, item int) error) ([]byte, error) {
+	sections := split(data)
+	for i := range sections {
+		obj, err := decode(sections[i].body)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+		if len(obj) == 0 {
+			continue
+		}
+
+		if !isList(obj) {
+			if match(obj) {
+				if err := change(&sections[i], obj, -1); err != nil {
+					return nil, err
+				}
+				return join(sections), nil
+			}
+			continue
+		}
+
+		items, _ := obj["items"].([]interface{})
+		for j, item := range items {
+			itemObj, ok := item.(map[string]interface{})
+			if ok && match(itemObj) {
+				if err := change(&sections[i], obj, j); err != nil {
+					return nil, err
+				}
+				return join(sections), nil
+			}
+		}
+	}
+	return nil, ErrNotFound
+}
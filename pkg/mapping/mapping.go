@@ -1,54 +1,341 @@
 package mapping
 
 import (
-	"fmt"
+	"strings"
+	"sync"
 
+	gitbackedv1 "github.com/ibuildthecloud/gitbacked-controller/pkg/apis/gitbacked/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
 )
 
+// CRDGroupVersionKind is the kind of the CustomResourceDefinitions read from git, only the
+// group and kind are used for lookups so v1beta1 definitions are found too
+var CRDGroupVersionKind = schema.GroupVersionKind{
+	Group:   "apiextensions.k8s.io",
+	Version: "v1",
+	Kind:    "CustomResourceDefinition",
+}
+
+// Mapper is a RESTMapper for the kinds of the registered schemes and the
+// CustomResourceDefinitions found in git. Resource names of scheme kinds are guessed from
+// the kind. Their scope is read from the CustomResourceDefinition, the declared scopes or the
+// list of known cluster scoped kinds, in that order. Scheme kinds with none of them are not
+// mapped and fail with an UnknownScopeError.
 type Mapper struct {
+	lock    sync.Mutex
+	scopes  map[schema.GroupKind]meta.RESTScopeName
+	schemes []*runtime.Scheme
+	crds    []runtime.Object
+	mapper  meta.RESTMapper
+	unknown map[schema.GroupKind]bool
+	// types caches the result of ObjectType
+	types map[schema.GroupVersionKind]*typed.ParseableType
+}
+
+// New returns a mapper that uses scopes for the kinds registered in a scheme that are not
+// Kubernetes kinds
+func New(scopes map[schema.GroupKind]meta.RESTScopeName) *Mapper {
+	return &Mapper{
+		scopes: scopes,
+	}
+}
+
+// SetCRDs replaces the CustomResourceDefinitions known to the mapper
+func (m *Mapper) SetCRDs(crds []runtime.Object) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.crds = crds
+	m.mapper = nil
+	m.types = nil
+}
+
+// AddScheme adds the kinds of scheme to the mapper
+func (m *Mapper) AddScheme(scheme *runtime.Scheme) {
+	if scheme == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, existing := range m.schemes {
+		if existing == scheme {
+			return
+		}
+	}
+	m.schemes = append(m.schemes, scheme)
+	m.mapper = nil
+	m.types = nil
+}
+
+func (m *Mapper) current() (meta.RESTMapper, map[schema.GroupKind]bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.mapper == nil {
+		m.mapper, m.unknown = m.build()
+	}
+	return m.mapper, m.unknown
+}
+
+type groupVersions struct {
+	seen   map[schema.GroupVersion]bool
+	result []schema.GroupVersion
+}
+
+func (g *groupVersions) add(gv schema.GroupVersion) {
+	if !g.seen[gv] {
+		g.seen[gv] = true
+		g.result = append(g.result, gv)
+	}
+}
+
+// build returns the mapper and the scheme kinds that were left out because their scope is
+// unknown
+func (m *Mapper) build() (meta.RESTMapper, map[schema.GroupKind]bool) {
+	gvs := &groupVersions{
+		seen: map[schema.GroupVersion]bool{},
+	}
+	for _, scheme := range m.schemes {
+		for _, gv := range scheme.PrioritizedVersionsAllGroups() {
+			gvs.add(gv)
+		}
+	}
+
+	crdMappings := parseCRDs(m.crds)
+	for _, mapping := range crdMappings {
+		gvs.add(mapping.GroupVersionKind.GroupVersion())
+	}
+	// the definitions themselves are always known since they are read from git, as is the
+	// repository status served by the store
+	builtinKinds := []schema.GroupVersionKind{
+		CRDGroupVersionKind,
+		CRDGroupVersionKind.GroupKind().WithVersion("v1beta1"),
+		gitbackedv1.SchemeGroupVersion.WithKind("GitRepositoryStatus"),
+	}
+	for _, gvk := range builtinKinds {
+		gvs.add(gvk.GroupVersion())
+	}
+
+	defined := map[schema.GroupKind]bool{}
+	for _, mapping := range crdMappings {
+		defined[mapping.GroupVersionKind.GroupKind()] = true
+	}
+
+	mapper := meta.NewDefaultRESTMapper(gvs.result)
+	unknown := map[schema.GroupKind]bool{}
+	for _, gvk := range builtinKinds {
+		mapper.Add(gvk, meta.RESTScopeRoot)
+	}
+	for _, scheme := range m.schemes {
+		for gvk := range scheme.AllKnownTypes() {
+			if !isObject(scheme, gvk) || defined[gvk.GroupKind()] {
+				continue
+			}
+			scope, ok := m.scopeOf(gvk.GroupKind())
+			if !ok {
+				unknown[gvk.GroupKind()] = true
+				continue
+			}
+			mapper.Add(gvk, scope)
+		}
+	}
+	for _, mapping := range crdMappings {
+		mapper.AddSpecific(mapping.GroupVersionKind, mapping.Resource, mapping.singular, mapping.Scope)
+	}
+
+	return mapper, unknown
+}
+
+// isObject returns true for the kinds that are stored as objects, skipping lists, options
+// and other types registered in the scheme
+func isObject(scheme *runtime.Scheme, gvk schema.GroupVersionKind) bool {
+	if gvk.Version == runtime.APIVersionInternal || strings.HasSuffix(gvk.Kind, "List") {
+		return false
+	}
+	obj, err := scheme.New(gvk)
+	if err != nil {
+		return false
+	}
+	if unversioned, _ := scheme.IsUnversioned(obj); unversioned {
+		return false
+	}
+	_, err = meta.Accessor(obj)
+	return err == nil
+}
+
+// scopeOf returns the declared scope of a scheme kind, or the scope of a Kubernetes kind.
+// The scope of other kinds is not guessed.
+func (m *Mapper) scopeOf(gk schema.GroupKind) (meta.RESTScope, bool) {
+	switch m.scopes[gk] {
+	case meta.RESTScopeNameRoot:
+		return meta.RESTScopeRoot, true
+	case meta.RESTScopeNameNamespace:
+		return meta.RESTScopeNamespace, true
+	}
+	if clusterScoped[gk] {
+		return meta.RESTScopeRoot, true
+	}
+	if kubernetesGroup(gk.Group) {
+		return meta.RESTScopeNamespace, true
+	}
+	return nil, false
+}
+
+type crdMapping struct {
+	meta.RESTMapping
+	singular schema.GroupVersionResource
 }
 
-func (m Mapper) KindFor(resource schema.GroupVersionResource) (schema.GroupVersionKind, error) {
-	panic("implement me")
+// parseCRDs reads the mappings of both apiextensions.k8s.io/v1 and v1beta1 definitions
+func parseCRDs(crds []runtime.Object) []crdMapping {
+	var result []crdMapping
+	for _, obj := range crds {
+		crd, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+		plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+		singular, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "singular")
+		scope, _, _ := unstructured.NestedString(crd.Object, "spec", "scope")
+		if kind == "" || plural == "" {
+			continue
+		}
+		if singular == "" {
+			singular = strings.ToLower(kind)
+		}
+
+		restScope := meta.RESTScopeNamespace
+		if scope == "Cluster" {
+			restScope = meta.RESTScopeRoot
+		}
+
+		for _, version := range crdVersions(crd) {
+			result = append(result, crdMapping{
+				RESTMapping: meta.RESTMapping{
+					Resource: schema.GroupVersionResource{
+						Group:    group,
+						Version:  version,
+						Resource: plural,
+					},
+					GroupVersionKind: schema.GroupVersionKind{
+						Group:   group,
+						Version: version,
+						Kind:    kind,
+					},
+					Scope: restScope,
+				},
+				singular: schema.GroupVersionResource{
+					Group:    group,
+					Version:  version,
+					Resource: singular,
+				},
+			})
+		}
+	}
+	return result
+}
+
+func crdVersions(crd *unstructured.Unstructured) []string {
+	var result []string
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, version := range versions {
+		version, ok := version.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if served, ok := version["served"].(bool); ok && !served {
+			continue
+		}
+		if name, ok := version["name"].(string); ok && name != "" {
+			result = append(result, name)
+		}
+	}
+	if len(result) == 0 {
+		// v1beta1 definitions may only have spec.version
+		if version, _, _ := unstructured.NestedString(crd.Object, "spec", "version"); version != "" {
+			result = append(result, version)
+		}
+	}
+	return result
 }
 
-func (m Mapper) KindsFor(resource schema.GroupVersionResource) ([]schema.GroupVersionKind, error) {
-	panic("implement me")
+func (m *Mapper) KindFor(resource schema.GroupVersionResource) (schema.GroupVersionKind, error) {
+	mapper, _ := m.current()
+	return mapper.KindFor(resource)
 }
 
-func (m Mapper) ResourceFor(input schema.GroupVersionResource) (schema.GroupVersionResource, error) {
-	panic("implement me")
+func (m *Mapper) KindsFor(resource schema.GroupVersionResource) ([]schema.GroupVersionKind, error) {
+	mapper, _ := m.current()
+	return mapper.KindsFor(resource)
 }
 
-func (m Mapper) ResourcesFor(input schema.GroupVersionResource) ([]schema.GroupVersionResource, error) {
-	panic("implement me")
+func (m *Mapper) ResourceFor(input schema.GroupVersionResource) (schema.GroupVersionResource, error) {
+	mapper, _ := m.current()
+	return mapper.ResourceFor(input)
 }
 
-func (m Mapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
-	if len(versions) == 0 {
-		return nil, fmt.Errorf("one version is required")
+func (m *Mapper) ResourcesFor(input schema.GroupVersionResource) ([]schema.GroupVersionResource, error) {
+	mapper, _ := m.current()
+	return mapper.ResourcesFor(input)
+}
+
+func (m *Mapper) RESTMapping(gk schema.GroupKind, versions ...string) (*meta.RESTMapping, error) {
+	mapper, unknown := m.current()
+	if unknown[gk] {
+		return nil, &UnknownScopeError{GroupKind: gk}
+	}
+	return mapper.RESTMapping(gk, versions...)
+}
+
+func (m *Mapper) RESTMappings(gk schema.GroupKind, versions ...string) ([]*meta.RESTMapping, error) {
+	mapper, unknown := m.current()
+	if unknown[gk] {
+		return nil, &UnknownScopeError{GroupKind: gk}
 	}
-	return &meta.RESTMapping{
-		Resource: schema.GroupVersionResource{
-			Group:    gk.Group,
-			Version:  versions[0],
-			Resource: gk.Kind,
-		},
-		GroupVersionKind: schema.GroupVersionKind{
-			Group:   gk.Group,
-			Version: versions[0],
-			Kind:    gk.Kind,
-		},
-		Scope: meta.RESTScopeNamespace,
-	}, nil
+	return mapper.RESTMappings(gk, versions...)
 }
 
-func (m Mapper) RESTMappings(gk schema.GroupKind, versions ...string) ([]*meta.RESTMapping, error) {
-	panic("implement me")
+func (m *Mapper) ResourceSingularizer(resource string) (singular string, err error) {
+	mapper, _ := m.current()
+	return mapper.ResourceSingularizer(resource)
 }
 
-func (m Mapper) ResourceSingularizer(resource string) (singular string, err error) {
-	panic("implement me")
+// OpenAPISchema returns the openAPIV3Schema of gvk from the CustomResourceDefinition in crds
+// that defines it, nil if there is none
+func OpenAPISchema(crds []runtime.Object, gvk schema.GroupVersionKind) map[string]interface{} {
+	for _, obj := range crds {
+		crd, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+
+		group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "kind")
+		if group != gvk.Group || kind != gvk.Kind {
+			continue
+		}
+
+		versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+		for _, version := range versions {
+			version, ok := version.(map[string]interface{})
+			if !ok || version["name"] != gvk.Version {
+				continue
+			}
+			if schema, ok, _ := unstructured.NestedMap(version, "schema", "openAPIV3Schema"); ok {
+				return schema
+			}
+		}
+		// v1beta1 definitions may have one schema for all versions
+		if schema, ok, _ := unstructured.NestedMap(crd.Object, "spec", "validation", "openAPIV3Schema"); ok {
+			return schema
+		}
+	}
+	return nil
 }
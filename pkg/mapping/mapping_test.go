@@ -0,0 +1,105 @@
+package mapping
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+var exampleGroupVersion = schema.GroupVersion{Group: "example.com", Version: "v1"}
+
+func newScheme(t *testing.T) *runtime.Scheme {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	// custom kinds, backed by ConfigMap since only the kind matters to the mapper
+	scheme.AddKnownTypeWithName(exampleGroupVersion.WithKind("Declared"), &corev1.ConfigMap{})
+	scheme.AddKnownTypeWithName(exampleGroupVersion.WithKind("Defined"), &corev1.ConfigMap{})
+	scheme.AddKnownTypeWithName(exampleGroupVersion.WithKind("Undeclared"), &corev1.ConfigMap{})
+	metav1.AddToGroupVersion(scheme, exampleGroupVersion)
+	return scheme
+}
+
+func TestScope(t *testing.T) {
+	m := New(map[schema.GroupKind]meta.RESTScopeName{
+		exampleGroupVersion.WithKind("Declared").GroupKind(): meta.RESTScopeNameRoot,
+		exampleGroupVersion.WithKind("Defined").GroupKind():  meta.RESTScopeNameRoot,
+	})
+	m.AddScheme(newScheme(t))
+	m.SetCRDs([]runtime.Object{
+		&unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apiextensions.k8s.io/v1",
+			"kind":       "CustomResourceDefinition",
+			"spec": map[string]interface{}{
+				"group": "example.com",
+				"scope": "Namespaced",
+				"names": map[string]interface{}{
+					"kind":   "Defined",
+					"plural": "defineds",
+				},
+				"versions": []interface{}{
+					map[string]interface{}{"name": "v1", "served": true},
+				},
+			},
+		}},
+	})
+
+	tests := []struct {
+		gvk     schema.GroupVersionKind
+		scope   meta.RESTScopeName
+		unknown bool
+	}{
+		{gvk: corev1.SchemeGroupVersion.WithKind("ConfigMap"), scope: meta.RESTScopeNameNamespace},
+		{gvk: corev1.SchemeGroupVersion.WithKind("Node"), scope: meta.RESTScopeNameRoot},
+		{gvk: exampleGroupVersion.WithKind("Declared"), scope: meta.RESTScopeNameRoot},
+		{gvk: exampleGroupVersion.WithKind("Defined"), scope: meta.RESTScopeNameNamespace},
+		{gvk: exampleGroupVersion.WithKind("Undeclared"), unknown: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.gvk.Kind, func(t *testing.T) {
+			mapping, err := m.RESTMapping(tt.gvk.GroupKind(), tt.gvk.Version)
+			if tt.unknown {
+				var unknown *UnknownScopeError
+				if !errors.As(err, &unknown) {
+					t.Fatalf("expected an UnknownScopeError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mapping.Scope.Name() != tt.scope {
+				t.Errorf("scope is %s, expected %s", mapping.Scope.Name(), tt.scope)
+			}
+		})
+	}
+}
+
+func TestObjectType(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	m := New(nil)
+	m.AddScheme(scheme)
+
+	for gvk := range scheme.AllKnownTypes() {
+		if !isObject(scheme, gvk) {
+			continue
+		}
+		if _, err := m.objectType(gvk); err != nil {
+			t.Errorf("type of %s: %v", gvk, err)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package mapping
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kube-openapi/pkg/schemaconv"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	smdschema "sigs.k8s.io/structured-merge-diff/v4/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+)
+
+// ObjectType returns the type used to track the managedFields of gvk, built from the Go type
+// registered in a scheme or else the schema of the CustomResourceDefinition in git. It returns
+// false if there is neither. Fields that are not in the type are deduced from their content.
+func (m *Mapper) ObjectType(gvk schema.GroupVersionKind) (typed.ParseableType, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.types == nil {
+		m.types = map[schema.GroupVersionKind]*typed.ParseableType{}
+	}
+	if objectType, ok := m.types[gvk]; ok {
+		if objectType == nil {
+			return typed.ParseableType{}, false
+		}
+		return *objectType, true
+	}
+
+	objectType, err := m.objectType(gvk)
+	if err != nil {
+		logrus.Warnf("Failed to build the type of %s, deducing it from objects: %v", gvk, err)
+	}
+	m.types[gvk] = objectType
+	if objectType == nil {
+		return typed.ParseableType{}, false
+	}
+	return *objectType, true
+}
+
+func (m *Mapper) objectType(gvk schema.GroupVersionKind) (*typed.ParseableType, error) {
+	path := proto.NewPath(gvk.Kind)
+	var model proto.Schema
+	for _, scheme := range m.schemes {
+		if !scheme.Recognizes(gvk) {
+			continue
+		}
+		obj, err := scheme.New(gvk)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := obj.(runtime.Unstructured); !ok {
+			model = structProto(reflect.TypeOf(obj), &path, nil, nil)
+			break
+		}
+	}
+	if model == nil {
+		openAPISchema := OpenAPISchema(m.crds, gvk)
+		if openAPISchema == nil {
+			return nil, nil
+		}
+		model = withObjectMeta(ToProto(openAPISchema, &path))
+	}
+
+	name := gvk.String()
+	converted, err := schemaconv.ToSchemaWithPreserveUnknownFields(models{name: model}, true)
+	if err != nil {
+		return nil, err
+	}
+	return &typed.ParseableType{
+		Schema:  converted,
+		TypeRef: smdschema.TypeRef{NamedType: &name},
+	}, nil
+}
+
+// models are the proto.Models of a single kind
+type models map[string]proto.Schema
+
+func (m models) LookupModel(name string) proto.Schema {
+	return m[name]
+}
+
+func (m models) ListModels() []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
+
+// withObjectMeta sets the metadata of a CustomResourceDefinition schema to ObjectMeta, like the
+// apiserver does. The schemas of definitions usually leave it out.
+func withObjectMeta(model proto.Schema) proto.Schema {
+	kind, ok := model.(*proto.Kind)
+	if !ok {
+		kind = &proto.Kind{
+			BaseSchema: proto.BaseSchema{
+				Extensions: map[string]interface{}{"x-kubernetes-preserve-unknown-fields": true},
+				Path:       *model.GetPath(),
+			},
+			Fields: map[string]proto.Schema{},
+		}
+	}
+	metadataPath := model.GetPath().FieldPath("metadata")
+	if _, ok := kind.Fields["metadata"]; !ok {
+		kind.FieldOrder = append(kind.FieldOrder, "metadata")
+	}
+	kind.Fields["metadata"] = structProto(reflect.TypeOf(metav1.ObjectMeta{}), &metadataPath, nil, nil)
+	return kind
+}
+
+var marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// structProto converts a Go type to a schema the way it is encoded to JSON. Lists with a
+// patchStrategy of merge are sets, or maps if they have a patchMergeKey, like for strategic
+// merge patches. Types with their own encoding, such as Time and Quantity, and recursive types
+// are arbitrary. parents are the structs t is in.
+func structProto(t reflect.Type, path *proto.Path, extensions map[string]interface{}, parents []reflect.Type) proto.Schema {
+	base := proto.BaseSchema{
+		Extensions: extensions,
+		Path:       *path,
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return &proto.Arbitrary{BaseSchema: base}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for _, parent := range parents {
+			if parent == t {
+				return &proto.Arbitrary{BaseSchema: base}
+			}
+		}
+		kind := &proto.Kind{
+			BaseSchema: base,
+			Fields:     map[string]proto.Schema{},
+		}
+		addFields(kind, t, path, append(parents, t))
+		return kind
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &proto.Primitive{BaseSchema: base, Type: proto.String, Format: "byte"}
+		}
+		itemPath := path.ArrayPath(0)
+		return &proto.Array{
+			BaseSchema: base,
+			SubType:    structProto(t.Elem(), &itemPath, nil, parents),
+		}
+	case reflect.Map:
+		valuePath := path.FieldPath("value")
+		return &proto.Map{
+			BaseSchema: base,
+			SubType:    structProto(t.Elem(), &valuePath, nil, parents),
+		}
+	case reflect.String:
+		return &proto.Primitive{BaseSchema: base, Type: proto.String}
+	case reflect.Bool:
+		return &proto.Primitive{BaseSchema: base, Type: proto.Boolean}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &proto.Primitive{BaseSchema: base, Type: proto.Integer}
+	case reflect.Float32, reflect.Float64:
+		return &proto.Primitive{BaseSchema: base, Type: proto.Number}
+	}
+	return &proto.Arbitrary{BaseSchema: base}
+}
+
+// addFields adds the JSON fields of struct t to kind, inlining embedded structs
+func addFields(kind *proto.Kind, t reflect.Type, path *proto.Path, parents []reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, inline := jsonName(field)
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && (name == "" || inline) {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				addFields(kind, embedded, path, parents)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		var extensions map[string]interface{}
+		if strategy := field.Tag.Get("patchStrategy"); strings.Contains(strategy, "merge") && field.Type.Kind() == reflect.Slice {
+			extensions = map[string]interface{}{"x-kubernetes-patch-strategy": strategy}
+			if key := field.Tag.Get("patchMergeKey"); key != "" {
+				extensions["x-kubernetes-patch-merge-key"] = key
+			}
+		}
+		fieldPath := path.FieldPath(name)
+		if _, ok := kind.Fields[name]; !ok {
+			kind.FieldOrder = append(kind.FieldOrder, name)
+		}
+		kind.Fields[name] = structProto(field.Type, &fieldPath, extensions, parents)
+	}
+}
+
+// jsonName returns the name of field in its json tag and if it is inlined
+func jsonName(field reflect.StructField) (string, bool) {
+	parts := strings.Split(field.Tag.Get("json"), ",")
+	for _, opt := range parts[1:] {
+		if opt == "inline" {
+			return parts[0], true
+		}
+	}
+	return parts[0], false
+}
+
+// ToProto converts an OpenAPI v3 schema of a CustomResourceDefinition to a proto.Schema. The
+// x-kubernetes extensions are kept and list types are also translated to the extensions of
+// strategic merge patches: lists of type map with a single key are merged on that key and
+// lists of type set are merged as sets, every other list is replaced. Objects without
+// properties are arbitrary.
+func ToProto(openAPISchema map[string]interface{}, path *proto.Path) proto.Schema {
+	base := proto.BaseSchema{
+		Extensions: extensions(openAPISchema),
+		Path:       *path,
+	}
+
+	switch openAPISchema["type"] {
+	case "object":
+		properties, ok := openAPISchema["properties"].(map[string]interface{})
+		if !ok {
+			return &proto.Arbitrary{BaseSchema: base}
+		}
+		kind := &proto.Kind{
+			BaseSchema: base,
+			Fields:     map[string]proto.Schema{},
+		}
+		for name, property := range properties {
+			property, ok := property.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			fieldPath := path.FieldPath(name)
+			kind.Fields[name] = ToProto(property, &fieldPath)
+			kind.FieldOrder = append(kind.FieldOrder, name)
+		}
+		return kind
+	case "array":
+		itemPath := path.ArrayPath(0)
+		var items proto.Schema = &proto.Arbitrary{BaseSchema: proto.BaseSchema{Path: itemPath}}
+		if itemSchema, ok := openAPISchema["items"].(map[string]interface{}); ok {
+			items = ToProto(itemSchema, &itemPath)
+		}
+		return &proto.Array{
+			BaseSchema: base,
+			SubType:    items,
+		}
+	case "string", "integer", "number", "boolean":
+		return &proto.Primitive{
+			BaseSchema: base,
+			Type:       openAPISchema["type"].(string),
+		}
+	}
+	return &proto.Arbitrary{BaseSchema: base}
+}
+
+// extensions returns the x-kubernetes extensions of a structural schema with the list type
+// translated to the extensions used for strategic merge patches
+func extensions(openAPISchema map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+	for key, value := range openAPISchema {
+		if strings.HasPrefix(key, "x-kubernetes-") {
+			result[key] = value
+		}
+	}
+
+	switch openAPISchema["x-kubernetes-list-type"] {
+	case "map":
+		// strategic merge patches only have a single merge key
+		if keys, _ := openAPISchema["x-kubernetes-list-map-keys"].([]interface{}); len(keys) == 1 {
+			result["x-kubernetes-patch-strategy"] = "merge"
+			result["x-kubernetes-patch-merge-key"] = keys[0]
+		}
+	case "set":
+		result["x-kubernetes-patch-strategy"] = "merge"
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
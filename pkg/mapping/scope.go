@@ -0,0 +1,62 @@
+package mapping
+
+import (
+	"fmt"
+	"strings"
+
+	gitbackedv1 "github.com/ibuildthecloud/gitbacked-controller/pkg/apis/gitbacked/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// clusterScoped are the built-in kinds that are not namespaced, all other kinds of the
+// Kubernetes API groups are namespaced
+var clusterScoped = map[schema.GroupKind]bool{
+	{Group: "", Kind: "ComponentStatus"}:                                            true,
+	{Group: "", Kind: "Namespace"}:                                                  true,
+	{Group: "", Kind: "Node"}:                                                       true,
+	{Group: "", Kind: "PersistentVolume"}:                                           true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:   true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}: true,
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:               true,
+	{Group: "apiregistration.k8s.io", Kind: "APIService"}:                           true,
+	{Group: "authentication.k8s.io", Kind: "TokenReview"}:                           true,
+	{Group: "authorization.k8s.io", Kind: "SelfSubjectAccessReview"}:                true,
+	{Group: "authorization.k8s.io", Kind: "SelfSubjectRulesReview"}:                 true,
+	{Group: "authorization.k8s.io", Kind: "SubjectAccessReview"}:                    true,
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"}:               true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "FlowSchema"}:                     true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "PriorityLevelConfiguration"}:     true,
+	{Group: "networking.k8s.io", Kind: "IngressClass"}:                              true,
+	{Group: "node.k8s.io", Kind: "RuntimeClass"}:                                    true,
+	{Group: "policy", Kind: "PodSecurityPolicy"}:                                    true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:                       true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:                true,
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:                             true,
+	{Group: "storage.k8s.io", Kind: "CSIDriver"}:                                    true,
+	{Group: "storage.k8s.io", Kind: "CSINode"}:                                      true,
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:                                 true,
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"}:                             true,
+	{Group: gitbackedv1.SchemeGroupVersion.Group, Kind: "GitRepositoryStatus"}:      true,
+}
+
+// kubernetesGroup returns true for the groups of the Kubernetes API, the scope of their kinds
+// is known from clusterScoped
+func kubernetesGroup(group string) bool {
+	switch group {
+	case "", "apps", "autoscaling", "batch", "extensions", "policy", gitbackedv1.SchemeGroupVersion.Group:
+		return true
+	}
+	return strings.HasSuffix(group, ".k8s.io")
+}
+
+// UnknownScopeError is returned for kinds that are registered in a scheme, but are not
+// Kubernetes kinds, are not defined by a CustomResourceDefinition in git and have no
+// declared scope
+type UnknownScopeError struct {
+	GroupKind schema.GroupKind
+}
+
+func (e *UnknownScopeError) Error() string {
+	return fmt.Sprintf("scope of %s is unknown, add its CustomResourceDefinition to git or declare its scope in the options",
+		e.GroupKind)
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Apply merges the fields of obj into the stored object as the field manager of ctx, creating
+// the object if it does not exist. Fields owned by other managers are only changed if force
+// is set, otherwise the apply fails with a conflict.
+func (s *Store) Apply(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object, force bool) (runtime.Object, error) {
+	s.contentLock.Lock()
+	w, err := s.apply(ctx, gvk, obj, force)
+	s.contentLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.wait(w)
+}
+
+func (s *Store) apply(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object, force bool) (*pendingWrite, error) {
+	if err := readOnly(gvk, "patch"); err != nil {
+		return nil, err
+	}
+
+	config, err := toUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	config.SetGroupVersionKind(gvk)
+
+	key := keyFor(gvk, config.GetNamespace(), config.GetName())
+	if err := s.flushPending(key); err != nil {
+		return nil, err
+	}
+
+	found := s.get(gvk, key.Namespace, key.Name)
+	if rv := config.GetResourceVersion(); rv != "" && rv != found.ResourceVersion {
+		return nil, errors.NewConflict(schema.GroupResource{
+			Group:    gvk.Group,
+			Resource: gvk.Kind,
+		}, key.Name, fmt.Errorf("resourceVersion %s does not match requested %s", found.ResourceVersion, rv))
+	}
+
+	path := found.Path
+	op := OperationApply
+	if found.Object == nil {
+		path, err = s.newPath(gvk, key.Namespace, key.Name, config.GetLabels(), config.GetAnnotations())
+		if err != nil {
+			return nil, err
+		}
+		op = OperationCreate
+	}
+
+	applied, managedFields, err := applyManagedFields(s.typeOf(gvk), found.Object, config, found.ManagedFields, s.fieldManager(ctx), force, metav1.Now())
+	if err != nil {
+		return nil, err
+	}
+	if applied == nil {
+		if equality.Semantic.DeepEqual(found.ManagedFields, managedFields) {
+			return completed(found), nil
+		}
+		// only the managers changed, which is only committed if they are persisted
+		applied = found.Object.DeepCopy()
+	}
+	applied.SetGroupVersionKind(gvk)
+
+	if found.Object != nil && found.Object.GetDeletionTimestamp() != nil {
+		if err := checkDeleting(gvk, found, applied); err != nil {
+			return nil, err
+		}
+		if len(applied.GetFinalizers()) == 0 {
+			return s.remove(ctx, gvk, found)
+		}
+	}
+
+	return s.write(ctx, gvk, applied, found, path, op, managedFields)
+}
+
+// setManagedFields records a change of only the managedFields of an object as a new revision
+// without a commit, the file is the same
+func (s *Store) setManagedFields(obj Object, managedFields []metav1.ManagedFieldsEntry) Object {
+	defer s.contentBroadcast.Broadcast()
+
+	latest := s.latest()
+	version := latest.version + 1
+	obj.ResourceVersion = strconv.Itoa(version)
+	obj.ManagedFields = managedFields
+	obj.Object = obj.Object.DeepCopy()
+	obj.Object.SetResourceVersion(obj.ResourceVersion)
+	obj.Object.SetManagedFields(managedFields)
+
+	data := make(map[ObjectKey]Object, len(latest.data))
+	for key, existing := range latest.data {
+		data[key] = existing
+	}
+	data[obj.ObjectKey] = obj
+	s.appendRevision(Revision{
+		version: version,
+		data:    data,
+		// the labels and namespace did not change
+		index:    latest.index,
+		modified: []Object{obj},
+	})
+	return obj
+}
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/git"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// pendingWrite is a write that has been staged in the working tree and is waiting for the
+// batch it belongs to be committed and pushed
+type pendingWrite struct {
+	key     ObjectKey
+	message string
+	// apply changes the working tree, it is run again if the push is rejected
+	apply func() error
+	// base is the object the write was checked against, Object is nil for creates
+	base Object
+	// managedFields of the written object
+	managedFields []metav1.ManagedFieldsEntry
+	done          chan struct{}
+	err           error
+	result        Object
+}
+
+// batch is the set of writes that will be committed and pushed together
+type batch struct {
+	writes []*pendingWrite
+	keys   map[ObjectKey]bool
+	timer  *time.Timer
+	// held batches are only committed by an explicit flush
+	held bool
+	// a conflict fails every write of a transaction batch
+	transaction bool
+}
+
+func (b *batch) message() string {
+	var (
+		messages []string
+		seen     = map[string]bool{}
+	)
+	for _, w := range b.writes {
+		if !seen[w.message] {
+			seen[w.message] = true
+			messages = append(messages, w.message)
+		}
+	}
+
+	if len(messages) == 1 {
+		return messages[0]
+	}
+	return fmt.Sprintf("update %d objects\n\n%s", len(b.writes), strings.Join(messages, "\n\n"))
+}
+
+// pending returns true if there is a staged but not yet committed write to key
+func (s *Store) pending(key ObjectKey) bool {
+	return s.batch != nil && s.batch.keys[key]
+}
+
+// flushPending commits the current batch if it contains a write to key so that the write
+// can be checked against the result, preserving resourceVersion conflict semantics
+func (s *Store) flushPending(key ObjectKey) error {
+	if !s.pending(key) {
+		return nil
+	}
+	return s.flush()
+}
+
+// stage runs apply to change the working tree and adds the write to the current batch. The
+// batch is committed immediately if batching is disabled or the batch is full, otherwise
+// when the batch window expires.
+func (s *Store) stage(ctx context.Context, key ObjectKey, message string, managedFields []metav1.ManagedFieldsEntry, apply func() error) (*pendingWrite, error) {
+	if err := apply(); err != nil {
+		return nil, err
+	}
+
+	if s.batch == nil {
+		s.batch = &batch{
+			keys: map[ObjectKey]bool{},
+		}
+	}
+
+	w := &pendingWrite{
+		key:           key,
+		message:       message,
+		apply:         apply,
+		base:          s.latest().data[key],
+		managedFields: managedFields,
+		done:          make(chan struct{}),
+	}
+	s.batch.writes = append(s.batch.writes, w)
+	s.batch.keys[key] = true
+
+	if s.batch.held {
+		return w, nil
+	}
+
+	if s.batchWindow <= 0 || (s.batchSize > 0 && len(s.batch.writes) >= s.batchSize) {
+		// the result is reported through the pendingWrite
+		_ = s.flush()
+	} else if s.batch.timer == nil {
+		s.batch.timer = time.AfterFunc(s.batchWindow, s.flushTimer)
+	}
+
+	return w, nil
+}
+
+// completed returns a write that is already done, for writes that do not change anything
+func completed(result Object) *pendingWrite {
+	w := &pendingWrite{
+		key:    result.ObjectKey,
+		result: result,
+		done:   make(chan struct{}),
+	}
+	close(w.done)
+	return w
+}
+
+func (s *Store) flushTimer() {
+	s.contentLock.Lock()
+	defer s.contentLock.Unlock()
+	if err := s.flush(); err != nil {
+		logrus.Errorf("failed to commit batch: %v", err)
+	}
+}
+
+// flush commits and pushes the current batch and records the result of every write in it.
+// Must be called with the contentLock held.
+func (s *Store) flush() error {
+	b := s.batch
+	s.batch = nil
+	if b == nil || len(b.writes) == 0 {
+		return nil
+	}
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+
+	err := s.commitAndPush(b)
+	if err != nil {
+		s.pushError = err
+		s.publishStatus()
+	}
+	for _, w := range b.writes {
+		w.err = err
+		if err == nil {
+			w.result = s.latest().data[w.key]
+		}
+		close(w.done)
+	}
+
+	return err
+}
+
+// commitAndPush commits the batch and pushes it. If the push is rejected because the remote
+// branch moved, the working tree is reset to the new remote head and rescanned. Writes whose
+// object changed in the meantime fail with a conflict and the remaining writes are applied
+// again and pushed, with backoff between attempts.
+func (s *Store) commitAndPush(b *batch) error {
+	backoff := s.pushBackoff
+	for {
+		err := s.repo.Commit(s.ctx, b.message())
+		if err == nil {
+			s.pushError = nil
+			s.written = map[ObjectKey][]metav1.ManagedFieldsEntry{}
+			for _, w := range b.writes {
+				s.written[w.key] = w.managedFields
+			}
+			err = s.scanAndUpdate()
+			s.written = nil
+			return err
+		}
+
+		var pushErr *git.PushError
+		if !errors.As(err, &pushErr) || backoff.Steps <= 0 {
+			return err
+		}
+
+		logrus.Infof("push rejected, retrying: %v", err)
+		select {
+		case <-s.ctx.Done():
+			return err
+		case <-time.After(backoff.Step()):
+		}
+
+		if err := s.repo.Sync(s.ctx); err != nil {
+			return err
+		}
+		if err := s.scanAndUpdate(); err != nil {
+			return err
+		}
+
+		if err := s.rebase(b); err != nil {
+			return err
+		}
+		if len(b.writes) == 0 {
+			return nil
+		}
+	}
+}
+
+// rebase checks the writes of b against the current revision and applies the writes that do
+// not conflict to the working tree again. Conflicting writes are completed with a conflict
+// error, unless b is a transaction in which case the whole batch fails.
+func (s *Store) rebase(b *batch) error {
+	var (
+		current = s.latest()
+		writes  []*pendingWrite
+	)
+
+	for _, w := range b.writes {
+		if err := w.checkUnchanged(current.data[w.key]); err != nil {
+			if b.transaction {
+				return err
+			}
+			w.err = err
+			close(w.done)
+			continue
+		}
+		writes = append(writes, w)
+	}
+
+	b.writes = writes
+	for _, w := range b.writes {
+		if err := w.apply(); err != nil {
+			if resetErr := s.repo.Reset(s.ctx); resetErr != nil {
+				logrus.Errorf("failed to reset repo: %v", resetErr)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *pendingWrite) checkUnchanged(current Object) error {
+	if (w.base.Object == nil) == (current.Object == nil) &&
+		w.base.ResourceVersion == current.ResourceVersion {
+		return nil
+	}
+
+	return apierrors.NewConflict(schema.GroupResource{
+		Group:    w.key.Group,
+		Resource: w.key.Kind,
+	}, w.key.Name, fmt.Errorf("the object was changed in git while the write was being pushed"))
+}
+
+// wait blocks until the batch containing w is committed and returns the written object
+func (s *Store) wait(w *pendingWrite) (runtime.Object, error) {
+	<-w.done
+	if w.err != nil {
+		return nil, w.err
+	}
+	if w.result.Object == nil {
+		return nil, nil
+	}
+	return w.result.Object, nil
+}
+
+// Flush commits and pushes any batched writes immediately
+func (s *Store) Flush() error {
+	s.contentLock.Lock()
+	defer s.contentLock.Unlock()
+	return s.flush()
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const DefaultCommitMessageTemplate = `{{.Operation}} {{.Kind}} {{if .Namespace}}{{.Namespace}}/{{end}}{{.Name}}`
+
+type Operation string
+
+const (
+	OperationCreate Operation = "create"
+	OperationUpdate Operation = "update"
+	OperationDelete Operation = "delete"
+	OperationStatus Operation = "status"
+	OperationApply  Operation = "apply"
+)
+
+// CommitInfo is the data available to the commit message template
+type CommitInfo struct {
+	schema.GroupVersionKind
+
+	Operation    Operation
+	Namespace    string
+	Name         string
+	Generation   int64
+	FieldManager string
+}
+
+type commitMessageKey struct{}
+
+type commitTrailersKey struct{}
+
+// WithCommitMessage sets the commit message used for writes done with the returned context,
+// overriding the message template
+func WithCommitMessage(ctx context.Context, message string) context.Context {
+	return context.WithValue(ctx, commitMessageKey{}, message)
+}
+
+// WithCommitTrailer adds a "key: value" trailer to the commit message of writes done with
+// the returned context
+func WithCommitTrailer(ctx context.Context, key, value string) context.Context {
+	existing, _ := ctx.Value(commitTrailersKey{}).([]string)
+	trailers := append(existing[:len(existing):len(existing)], fmt.Sprintf("%s: %s", key, value))
+	return context.WithValue(ctx, commitTrailersKey{}, trailers)
+}
+
+func parseCommitMessageTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = DefaultCommitMessageTemplate
+	}
+	return template.New("commit").Option("missingkey=error").Parse(text)
+}
+
+func (s *Store) commitMessage(ctx context.Context, info CommitInfo) (string, error) {
+	message, ok := ctx.Value(commitMessageKey{}).(string)
+	if !ok {
+		buf := &bytes.Buffer{}
+		if err := s.commitTemplate.Execute(buf, info); err != nil {
+			return "", fmt.Errorf("failed to render commit message: %w", err)
+		}
+		message = buf.String()
+	}
+
+	message = strings.TrimSpace(message)
+	if trailers, _ := ctx.Value(commitTrailersKey{}).([]string); len(trailers) > 0 {
+		message += "\n\n" + strings.Join(trailers, "\n")
+	}
+	return message, nil
+}
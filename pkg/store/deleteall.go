@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// DeleteAllOf deletes the objects of gvk in namespace, or in all namespaces if it is empty,
+// that match both selectors. The objects are removed in a single commit. Objects that can not
+// be deleted, for example because the preconditions do not match, are skipped and their
+// errors are returned together once the others are deleted.
+func (s *Store) DeleteAllOf(ctx context.Context, gvk schema.GroupVersionKind, namespace string, labelSelector labels.Selector, fieldSelector fields.Selector,
+	preconditions *metav1.Preconditions, propagation *metav1.DeletionPropagation) error {
+	if err := readOnly(gvk, "deletecollection"); err != nil {
+		return err
+	}
+	if err := checkFieldSelector(fieldSelector); err != nil {
+		return err
+	}
+
+	s.contentLock.Lock()
+	writes, errs := s.deleteAllOf(ctx, gvk, namespace, labelSelector, fieldSelector, preconditions, propagation)
+	s.contentLock.Unlock()
+
+	for _, w := range writes {
+		if _, err := s.wait(w); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 1 {
+		// keep the status of a single error intact
+		return errs[0]
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (s *Store) deleteAllOf(ctx context.Context, gvk schema.GroupVersionKind, namespace string, labelSelector labels.Selector, fieldSelector fields.Selector,
+	preconditions *metav1.Preconditions, propagation *metav1.DeletionPropagation) ([]*pendingWrite, []error) {
+	// the deletes are never mixed with other writes
+	if err := s.flush(); err != nil {
+		logrus.Errorf("failed to commit batch: %v", err)
+	}
+
+	var (
+		rev    = s.latest()
+		keys   []ObjectKey
+		writes []*pendingWrite
+		errs   []error
+	)
+	if rev.index != nil {
+		for _, set := range rev.index.candidates(gvk.GroupKind(), namespace, labelSelector) {
+			for key := range set {
+				obj := rev.data[key]
+				if selected(obj, namespace, labelSelector) &&
+					(fieldSelector == nil || fieldSelector.Matches(objectFields(obj))) {
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keyLess(keys[i], keys[j])
+	})
+
+	s.batch = &batch{
+		keys: map[ObjectKey]bool{},
+		held: true,
+	}
+	for _, key := range keys {
+		w, err := s.delete(ctx, gvk, key.Namespace, key.Name, preconditions, propagation)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if w != nil {
+			writes = append(writes, w)
+		}
+	}
+
+	if len(writes) == 0 {
+		s.batch = nil
+		return nil, errs
+	}
+	// the result is reported through the pendingWrites
+	_ = s.flush()
+	return writes, errs
+}
+
+// checkFieldSelector rejects selectors on fields other than the name and namespace, which are
+// the only fields that can be selected on for every kind
+func checkFieldSelector(selector fields.Selector) error {
+	if selector == nil {
+		return nil
+	}
+	for _, requirement := range selector.Requirements() {
+		switch requirement.Field {
+		case "metadata.name", "metadata.namespace":
+		default:
+			return errors.NewBadRequest(fmt.Sprintf("field label not supported: %s", requirement.Field))
+		}
+	}
+	return nil
+}
+
+func objectFields(obj Object) fields.Set {
+	return fields.Set{
+		"metadata.name":      obj.Name,
+		"metadata.namespace": obj.Namespace,
+	}
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gitbackedv1 "github.com/ibuildthecloud/gitbacked-controller/pkg/apis/gitbacked/v1"
+	"github.com/sirupsen/logrus"
+)
+
+// DuplicatePolicy decides what happens when the same object is in more than one file or
+// document
+type DuplicatePolicy string
+
+const (
+	// DuplicateFirstWins uses the copy in the first file sorted by path
+	DuplicateFirstWins DuplicatePolicy = "FirstWins"
+	// DuplicateReject ignores every copy of the object, as if it was deleted
+	DuplicateReject DuplicatePolicy = "Reject"
+	// DuplicateError does not read the commit at all, the objects of the last commit without
+	// duplicates are kept until the duplicates are removed
+	DuplicateError DuplicatePolicy = "Error"
+)
+
+// checkDuplicates logs the duplicates found in commit, returning an error if the policy
+// rejects the commit
+func (s *Store) checkDuplicates(commit string) error {
+	if len(s.duplicates) == 0 {
+		return nil
+	}
+
+	var descriptions []string
+	for key, paths := range s.duplicates {
+		relative := make([]string, 0, len(paths))
+		for _, path := range paths {
+			relative = append(relative, s.relativePath(path))
+		}
+		description := fmt.Sprintf("%s %s in %s", key.Kind, objectName(key), strings.Join(relative, ", "))
+		logrus.Warnf("Duplicate %s, policy %s", description, s.policy())
+		descriptions = append(descriptions, description)
+	}
+
+	sort.Strings(descriptions)
+	if s.duplicatePolicy == DuplicateError {
+		return fmt.Errorf("commit %s has duplicate objects: %s", commit, strings.Join(descriptions, "; "))
+	}
+	return nil
+}
+
+func (s *Store) policy() DuplicatePolicy {
+	if s.duplicatePolicy == "" {
+		return DuplicateFirstWins
+	}
+	return s.duplicatePolicy
+}
+
+func objectName(key ObjectKey) string {
+	if key.Namespace == "" {
+		return key.Name
+	}
+	return key.Namespace + "/" + key.Name
+}
+
+// relativePath returns path relative to the subdirectory of the store
+func (s *Store) relativePath(path string) string {
+	if parts := s.relative(path); len(parts) > 0 {
+		return filepath.Join(parts...)
+	}
+	return path
+}
+
+func duplicateLess(a, b gitbackedv1.DuplicateObject) bool {
+	if a.Group != b.Group {
+		return a.Group < b.Group
+	}
+	if a.Kind != b.Kind {
+		return a.Kind < b.Kind
+	}
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
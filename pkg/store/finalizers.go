@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// markDeleted sets the deletionTimestamp of an object with finalizers instead of removing it,
+// adding finalizer if it is set. The object is removed once an update removes the last
+// finalizer. Deleting an object that is already being deleted changes nothing.
+func (s *Store) markDeleted(ctx context.Context, gvk schema.GroupVersionKind, found Object, finalizer string) (*pendingWrite, error) {
+	if found.Object.GetDeletionTimestamp() != nil {
+		return completed(found), nil
+	}
+
+	obj := found.Object.DeepCopy()
+	if finalizer != "" && !hasFinalizer(obj.GetFinalizers(), finalizer) {
+		obj.SetFinalizers(append(obj.GetFinalizers(), finalizer))
+	}
+	now := metav1.Now()
+	var gracePeriod int64
+	obj.SetDeletionTimestamp(&now)
+	obj.SetDeletionGracePeriodSeconds(&gracePeriod)
+	return s.save(ctx, gvk, obj, found, found.Path, OperationDelete)
+}
+
+// propagationFinalizer returns the finalizer that makes the garbage collector handle the
+// dependents of a deleted object with the propagation policy
+func (s *Store) propagationFinalizer(propagation *metav1.DeletionPropagation) string {
+	if !s.garbageCollection || propagation == nil {
+		return ""
+	}
+	switch *propagation {
+	case metav1.DeletePropagationForeground:
+		return metav1.FinalizerDeleteDependents
+	case metav1.DeletePropagationOrphan:
+		return metav1.FinalizerOrphanDependents
+	}
+	return ""
+}
+
+// checkDeleting validates an update of an object that is being deleted. Only the metadata and
+// status can change and no finalizers can be added.
+func checkDeleting(gvk schema.GroupVersionKind, found Object, obj client.Object) error {
+	existing := sets.NewString(found.Object.GetFinalizers()...)
+	for _, finalizer := range obj.GetFinalizers() {
+		if !existing.Has(finalizer) {
+			return errors.NewForbidden(schema.GroupResource{
+				Group:    gvk.Group,
+				Resource: gvk.Kind,
+			}, obj.GetName(), fmt.Errorf("no new finalizers can be added if the object is being deleted, found new finalizer %s", finalizer))
+		}
+	}
+
+	updated, err := toUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	if nextGeneration(found, updated) != found.Generation {
+		return errors.NewForbidden(schema.GroupResource{
+			Group:    gvk.Group,
+			Resource: gvk.Kind,
+		}, obj.GetName(), fmt.Errorf("only the metadata and status can be changed if the object is being deleted"))
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package store
+
+import (
+	"context"
+	"os"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// collectGarbage deletes the objects whose owners are gone every time the objects change,
+// until ctx is done
+func (s *Store) collectGarbage(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.gcTrigger:
+		}
+
+		tx := s.garbage()
+		if len(tx.ops) == 0 {
+			continue
+		}
+		if _, err := tx.Commit(ctx); err != nil {
+			// the next revision triggers another pass
+			logrus.Errorf("Failed to collect garbage: %v", err)
+		}
+	}
+}
+
+// triggerGC starts a garbage collection pass if one is not pending already
+func (s *Store) triggerGC() {
+	if s.gcTrigger == nil {
+		return
+	}
+	select {
+	case s.gcTrigger <- struct{}{}:
+	default:
+	}
+}
+
+// gcChange is the change to a single object in a garbage collection pass
+type gcChange struct {
+	gvk    schema.GroupVersionKind
+	delete bool
+	object *unstructured.Unstructured
+}
+
+// garbage returns the writes of a garbage collection pass in a transaction:
+//   - objects whose owners were all deleted are deleted
+//   - dependents of owners being deleted in the foreground are deleted, the owner is removed
+//     once it has no dependents left
+//   - dependents of owners being deleted with the orphan policy lose the owner reference
+//     and the owner is removed
+//
+// Owners are matched on the group, kind and name of the reference plus the UID. An owner
+// only counts as deleted if the store has seen it and it is no longer in git, not if it is
+// just not read, so nothing is collected while files have problems or duplicates.
+func (s *Store) garbage() *Transaction {
+	s.contentLock.RLock()
+	defer s.contentLock.RUnlock()
+
+	if len(s.problems) > 0 || len(s.duplicates) > 0 {
+		logrus.Debugf("Skipping garbage collection, %d files have problems and %d objects are duplicated", len(s.problems), len(s.duplicates))
+		return s.Begin()
+	}
+
+	var (
+		data       = s.latest().data
+		orphans    []Object
+		dependents = map[ObjectKey][]Object{}
+		changes    = map[ObjectKey]*gcChange{}
+	)
+	for _, obj := range data {
+		refs := obj.Object.GetOwnerReferences()
+		orphaned := len(refs) > 0
+		for _, ref := range refs {
+			if owner, ok := ownerOf(data, obj, ref); ok {
+				dependents[owner.ObjectKey] = append(dependents[owner.ObjectKey], obj)
+				orphaned = false
+			} else if !s.ownerDeleted(obj, ref) {
+				orphaned = false
+			}
+		}
+		if orphaned {
+			orphans = append(orphans, obj)
+		}
+	}
+
+	change := func(obj Object) *gcChange {
+		if c, ok := changes[obj.ObjectKey]; ok {
+			return c
+		}
+		c := &gcChange{
+			gvk:    schema.GroupVersionKind{Group: obj.Group, Version: obj.Version, Kind: obj.Kind},
+			object: obj.Object.DeepCopy(),
+		}
+		changes[obj.ObjectKey] = c
+		return c
+	}
+
+	for _, obj := range data {
+		if obj.Object.GetDeletionTimestamp() == nil {
+			continue
+		}
+		finalizers := obj.Object.GetFinalizers()
+		switch {
+		case hasFinalizer(finalizers, metav1.FinalizerOrphanDependents):
+			for _, dependent := range dependents[obj.ObjectKey] {
+				c := change(dependent)
+				c.object.SetOwnerReferences(withoutOwner(c.object.GetOwnerReferences(), obj.UID))
+			}
+			c := change(obj)
+			c.object.SetFinalizers(withoutFinalizer(c.object.GetFinalizers(), metav1.FinalizerOrphanDependents))
+		case hasFinalizer(finalizers, metav1.FinalizerDeleteDependents):
+			for _, dependent := range dependents[obj.ObjectKey] {
+				if dependent.Object.GetDeletionTimestamp() == nil {
+					change(dependent).delete = true
+				}
+			}
+			if len(dependents[obj.ObjectKey]) == 0 {
+				c := change(obj)
+				c.object.SetFinalizers(withoutFinalizer(c.object.GetFinalizers(), metav1.FinalizerDeleteDependents))
+			}
+		}
+	}
+
+	for _, obj := range orphans {
+		if obj.Object.GetDeletionTimestamp() == nil {
+			change(obj).delete = true
+		}
+	}
+
+	keys := make([]ObjectKey, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keyLess(keys[i], keys[j])
+	})
+
+	tx := s.Begin()
+	for _, key := range keys {
+		c := changes[key]
+		if c.delete {
+			logrus.Infof("Garbage collecting %s %s", key.Kind, objectName(key))
+			uid := data[key].UID
+			tx.Delete(c.gvk, key.Namespace, key.Name, &metav1.Preconditions{
+				UID: &uid,
+			})
+		} else {
+			tx.Update(c.gvk, c.object)
+		}
+	}
+	return tx
+}
+
+// identity is an object with its UID, an object that is created again is a new identity
+type identity struct {
+	ObjectKey
+	UID types.UID
+}
+
+// ownerKeys returns the keys ref can refer to, in the namespace of obj or in the cluster scope
+func ownerKeys(obj Object, ref metav1.OwnerReference) []ObjectKey {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil
+	}
+	key := ObjectKey{
+		Group:     gv.Group,
+		Kind:      ref.Kind,
+		Namespace: obj.Namespace,
+		Name:      ref.Name,
+	}
+	if key.Namespace == "" {
+		return []ObjectKey{key}
+	}
+	cluster := key
+	cluster.Namespace = ""
+	return []ObjectKey{key, cluster}
+}
+
+// ownerOf returns the object ref refers to, matched on group, kind, name and UID
+func ownerOf(data map[ObjectKey]Object, obj Object, ref metav1.OwnerReference) (Object, bool) {
+	for _, key := range ownerKeys(obj, ref) {
+		if owner, ok := data[key]; ok && owner.UID == ref.UID {
+			return owner, true
+		}
+	}
+	return Object{}, false
+}
+
+// ownerDeleted returns true if the store has seen the owner ref refers to and it was deleted.
+// An owner that was never seen, for example because it is outside of the subdirectory, or
+// one that is no longer read because its file is ignored is not deleted.
+func (s *Store) ownerDeleted(obj Object, ref metav1.OwnerReference) bool {
+	for _, key := range ownerKeys(obj, ref) {
+		path, ok := s.seen[identity{ObjectKey: key, UID: ref.UID}]
+		if !ok {
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return true
+		} else if err != nil {
+			return false
+		}
+		// the file was changed to not have the owner anymore
+		return !s.ignored(path)
+	}
+	return false
+}
+
+// trackOwners remembers the file of every object in data so that garbage collection can tell
+// whether an owner that is gone was deleted. Objects that are gone are forgotten once nothing
+// refers to them.
+func (s *Store) trackOwners(data map[ObjectKey]Object) {
+	if !s.garbageCollection {
+		return
+	}
+	if s.seen == nil {
+		s.seen = map[identity]string{}
+	}
+
+	referenced := map[types.UID]bool{}
+	for _, obj := range data {
+		if obj.Path != "" {
+			s.seen[identity{ObjectKey: obj.ObjectKey, UID: obj.UID}] = obj.Path
+		}
+		for _, ref := range obj.Object.GetOwnerReferences() {
+			referenced[ref.UID] = true
+		}
+	}
+	for id := range s.seen {
+		if current, ok := data[id.ObjectKey]; ok && current.UID == id.UID {
+			continue
+		}
+		if !referenced[id.UID] {
+			delete(s.seen, id)
+		}
+	}
+}
+
+func keyLess(a, b ObjectKey) bool {
+	if a.Group != b.Group {
+		return a.Group < b.Group
+	}
+	if a.Kind != b.Kind {
+		return a.Kind < b.Kind
+	}
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
+
+func hasFinalizer(finalizers []string, finalizer string) bool {
+	for _, f := range finalizers {
+		if f == finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutFinalizer(finalizers []string, finalizer string) []string {
+	var result []string
+	for _, f := range finalizers {
+		if f != finalizer {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+func withoutOwner(refs []metav1.OwnerReference, uid types.UID) []metav1.OwnerReference {
+	var result []metav1.OwnerReference
+	for _, ref := range refs {
+		if ref.UID != uid {
+			result = append(result, ref)
+		}
+	}
+	return result
+}
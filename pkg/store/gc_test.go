@@ -0,0 +1,227 @@
+package store
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/git"
+)
+
+const (
+	gcOwner = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: owner
+  namespace: ns
+  uid: owner-uid
+`
+	gcOther = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+  namespace: ns
+  uid: other-uid
+`
+	gcNode = `apiVersion: v1
+kind: Node
+metadata:
+  name: node
+  uid: node-uid
+`
+	gcDependent = `apiVersion: v1
+kind: Secret
+metadata:
+  name: dependent
+  namespace: ns
+  ownerReferences:
+  - apiVersion: v1
+    kind: ConfigMap
+    name: owner
+    uid: owner-uid
+`
+	gcDependentOfBoth = `apiVersion: v1
+kind: Secret
+metadata:
+  name: dependent
+  namespace: ns
+  ownerReferences:
+  - apiVersion: v1
+    kind: ConfigMap
+    name: owner
+    uid: owner-uid
+  - apiVersion: v1
+    kind: ConfigMap
+    name: other
+    uid: other-uid
+`
+	gcDependentOfNode = `apiVersion: v1
+kind: Secret
+metadata:
+  name: dependent
+  namespace: ns
+  ownerReferences:
+  - apiVersion: v1
+    kind: Node
+    name: node
+    uid: node-uid
+`
+)
+
+// writeFiles writes files relative to the repository of s, an empty content deletes the file
+func writeFiles(t *testing.T, s *Store, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		path := filepath.Join(s.repo.Dir, name)
+		if content == "" {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// rescan reads every file again and adds a revision with the objects, like the scan of a new
+// commit
+func rescan(t *testing.T, s *Store) {
+	t.Helper()
+
+	var paths []string
+	err := filepath.WalkDir(s.root(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.loadIgnore(paths)
+	s.files = map[string][]Object{}
+	s.problems = map[string][]string{}
+	s.readFiles(paths)
+	objects, duplicates := s.objects()
+	s.duplicates = duplicates
+	s.commit("", 0, objects)
+}
+
+func TestGarbage(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    DuplicatePolicy
+		subDir    string
+		before    map[string]string
+		after     map[string]string
+		collected bool
+	}{
+		{
+			name:   "owner exists",
+			before: map[string]string{"owner.yaml": gcOwner, "dependent.yaml": gcDependent},
+		},
+		{
+			name:      "owner file deleted",
+			before:    map[string]string{"owner.yaml": gcOwner, "dependent.yaml": gcDependent},
+			after:     map[string]string{"owner.yaml": ""},
+			collected: true,
+		},
+		{
+			name:      "owner removed from its file",
+			before:    map[string]string{"owner.yaml": gcOwner + "---\n" + gcOther, "dependent.yaml": gcDependent},
+			after:     map[string]string{"owner.yaml": gcOther},
+			collected: true,
+		},
+		{
+			name:      "owner created again",
+			before:    map[string]string{"owner.yaml": gcOwner, "dependent.yaml": gcDependent},
+			after:     map[string]string{"owner.yaml": gcOwner[:len(gcOwner)-len("owner-uid\n")] + "new-uid\n"},
+			collected: true,
+		},
+		{
+			name:   "malformed owner file",
+			before: map[string]string{"owner.yaml": gcOwner, "dependent.yaml": gcDependent},
+			after:  map[string]string{"owner.yaml": "kind: [\n"},
+		},
+		{
+			name:   "excluded owner",
+			before: map[string]string{"owner.yaml": gcOwner, "dependent.yaml": gcDependent},
+			after:  map[string]string{IgnoreFile: "owner.yaml\n"},
+		},
+		{
+			name:   "owner never seen",
+			before: map[string]string{"dependent.yaml": gcDependent},
+		},
+		{
+			name:   "owner outside of the subdirectory",
+			subDir: "sub",
+			before: map[string]string{"owner.yaml": gcOwner, "sub/dependent.yaml": gcDependent},
+		},
+		{
+			name:   "rejected duplicate owner",
+			policy: DuplicateReject,
+			before: map[string]string{"owner.yaml": gcOwner, "dependent.yaml": gcDependent},
+			after:  map[string]string{"copy.yaml": gcOwner},
+		},
+		{
+			name:   "one of the owners deleted",
+			before: map[string]string{"owner.yaml": gcOwner, "other.yaml": gcOther, "dependent.yaml": gcDependentOfBoth},
+			after:  map[string]string{"owner.yaml": ""},
+		},
+		{
+			name:      "all owners deleted",
+			before:    map[string]string{"owner.yaml": gcOwner, "other.yaml": gcOther, "dependent.yaml": gcDependentOfBoth},
+			after:     map[string]string{"owner.yaml": "", "other.yaml": ""},
+			collected: true,
+		},
+		{
+			name:      "cluster scoped owner deleted",
+			before:    map[string]string{"node.yaml": gcNode, "dependent.yaml": gcDependentOfNode},
+			after:     map[string]string{"node.yaml": ""},
+			collected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New("url", Options{
+				SubDirectory:      tt.subDir,
+				DuplicatePolicy:   tt.policy,
+				GarbageCollection: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.repo = &git.Repo{Dir: t.TempDir()}
+
+			writeFiles(t, s, tt.before)
+			rescan(t, s)
+			writeFiles(t, s, tt.after)
+			rescan(t, s)
+
+			var collected bool
+			for _, op := range s.garbage().ops {
+				if op.op == OperationDelete && op.gvk.Kind == "Secret" && op.namespace == "ns" && op.name == "dependent" {
+					collected = true
+				} else {
+					t.Errorf("unexpected %s of %s %s/%s", op.op, op.gvk.Kind, op.namespace, op.name)
+				}
+			}
+			if collected != tt.collected {
+				t.Errorf("collected is %v, expected %v", collected, tt.collected)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/sirupsen/logrus"
+)
+
+// IgnoreFile lists the files that are not manifests in gitignore syntax. It can be in any
+// directory under the subdirectory of the store and applies to the files below it.
+const IgnoreFile = ".gitbackedignore"
+
+func parsePatterns(globs []string) []gitignore.Pattern {
+	var result []gitignore.Pattern
+	for _, glob := range globs {
+		result = append(result, gitignore.ParsePattern(glob, nil))
+	}
+	return result
+}
+
+// loadIgnore reads the ignore files in paths, the Exclude patterns from the options are
+// applied after them so they can't be negated by an ignore file
+func (s *Store) loadIgnore(paths []string) {
+	var patterns []gitignore.Pattern
+	for _, path := range paths {
+		if filepath.Base(path) != IgnoreFile {
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			logrus.Errorf("Failed to read %s, skipping: %v", path, err)
+			continue
+		}
+
+		domain := s.relative(filepath.Dir(path))
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := strings.TrimRight(scanner.Text(), "\r")
+			if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+				continue
+			}
+			patterns = append(patterns, gitignore.ParsePattern(line, domain))
+		}
+	}
+
+	s.ignore = gitignore.NewMatcher(append(patterns, s.exclude...))
+}
+
+// relative splits path into its components relative to the root of the store
+func (s *Store) relative(path string) []string {
+	rel, err := filepath.Rel(s.root(), path)
+	if err != nil || rel == "." {
+		return nil
+	}
+	return strings.Split(filepath.ToSlash(rel), "/")
+}
+
+// ignored returns true if path is not included or is excluded by the ignore files or options
+func (s *Store) ignored(path string) bool {
+	parts := s.relative(path)
+	if s.include != nil && !s.include.Match(parts, false) {
+		return true
+	}
+	return s.ignore != nil && s.ignore.Match(parts, false)
+}
+
+// ignoreChanged returns true if one of paths is an ignore file
+func ignoreChanged(paths []string) bool {
+	for _, path := range paths {
+		if filepath.Base(path) == IgnoreFile {
+			return true
+		}
+	}
+	return false
+}
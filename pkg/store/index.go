@@ -0,0 +1,118 @@
+package store
+
+import (
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+type keySet map[ObjectKey]struct{}
+
+type labelKey struct {
+	schema.GroupKind
+	Label string
+}
+
+// index is built for the latest revision so that List only visits the objects of the
+// requested kind and namespace, or the objects matching the label selector
+type index struct {
+	// namespaces is kind -> namespace -> keys
+	namespaces map[schema.GroupKind]map[string]keySet
+	// labels is kind and label -> label value -> keys
+	labels map[labelKey]map[string]keySet
+}
+
+func newIndex(data map[ObjectKey]Object) *index {
+	idx := &index{
+		namespaces: map[schema.GroupKind]map[string]keySet{},
+		labels:     map[labelKey]map[string]keySet{},
+	}
+	for key, obj := range data {
+		idx.add(key, obj)
+	}
+	return idx
+}
+
+func (i *index) add(key ObjectKey, obj Object) {
+	gk := schema.GroupKind{Group: key.Group, Kind: key.Kind}
+
+	namespaces, ok := i.namespaces[gk]
+	if !ok {
+		namespaces = map[string]keySet{}
+		i.namespaces[gk] = namespaces
+	}
+	insert(namespaces, key.Namespace, key)
+
+	for k, v := range obj.Object.GetLabels() {
+		lk := labelKey{GroupKind: gk, Label: k}
+		values, ok := i.labels[lk]
+		if !ok {
+			values = map[string]keySet{}
+			i.labels[lk] = values
+		}
+		insert(values, v, key)
+	}
+}
+
+func insert(sets map[string]keySet, value string, key ObjectKey) {
+	set, ok := sets[value]
+	if !ok {
+		set = keySet{}
+		sets[value] = set
+	}
+	set[key] = struct{}{}
+}
+
+// candidates returns the keys that may match, the result must still be filtered by
+// namespace and selector. The smallest set found in the indexes is returned.
+func (i *index) candidates(gk schema.GroupKind, namespace string, selector labels.Selector) []keySet {
+	var (
+		best  []keySet
+		count = -1
+	)
+
+	consider := func(sets []keySet) {
+		n := 0
+		for _, set := range sets {
+			n += len(set)
+		}
+		if count == -1 || n < count {
+			best, count = sets, n
+		}
+	}
+
+	if namespace == "" {
+		var sets []keySet
+		for _, set := range i.namespaces[gk] {
+			sets = append(sets, set)
+		}
+		consider(sets)
+	} else {
+		consider([]keySet{i.namespaces[gk][namespace]})
+	}
+
+	if selector == nil {
+		return best
+	}
+	requirements, selectable := selector.Requirements()
+	if !selectable {
+		return best
+	}
+	for _, req := range requirements {
+		switch req.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+		default:
+			continue
+		}
+		values := i.labels[labelKey{GroupKind: gk, Label: req.Key()}]
+		var sets []keySet
+		for _, value := range req.Values().List() {
+			if set, ok := values[value]; ok {
+				sets = append(sets, set)
+			}
+		}
+		consider(sets)
+	}
+
+	return best
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	benchmarkSizes = []int{100, 1000, 10000}
+	benchmarkKinds = []string{"ConfigMap", "Secret", "Service", "Pod"}
+	configMapGVK   = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+)
+
+// newIndexedStore returns a store with n objects spread over 4 kinds, 10 namespaces and 100
+// values of the app label
+func newIndexedStore(n int) *Store {
+	data := map[ObjectKey]Object{}
+	for i := 0; i < n; i++ {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind(benchmarkKinds[i%len(benchmarkKinds)])
+		obj.SetNamespace(fmt.Sprintf("ns-%d", i%10))
+		obj.SetName(fmt.Sprintf("obj-%d", i))
+		obj.SetLabels(map[string]string{
+			"app": fmt.Sprintf("app-%d", i%100),
+		})
+
+		key := ObjectKey{
+			Kind:      obj.GetKind(),
+			Name:      obj.GetName(),
+			Namespace: obj.GetNamespace(),
+		}
+		data[key] = Object{
+			ObjectKey: key,
+			Version:   "v1",
+			Object:    obj,
+		}
+	}
+
+	return &Store{
+		revisions: []Revision{
+			{
+				version: 1,
+				data:    data,
+				index:   newIndex(data),
+			},
+		},
+	}
+}
+
+// scanList is the full scan of the latest revision that List replaced
+func (s *Store) scanList(gvk schema.GroupVersionKind, namespace string, selector labels.Selector) []*unstructured.Unstructured {
+	var items []*unstructured.Unstructured
+	for key, obj := range s.latest().data {
+		if key.Kind == gvk.Kind && key.Group == gvk.Group && selected(obj, namespace, selector) {
+			items = append(items, obj.Object)
+		}
+	}
+	return items
+}
+
+// scanGet is the lookup by full scan that Get replaced
+func (s *Store) scanGet(gvk schema.GroupVersionKind, namespace, name string) Object {
+	for key, obj := range s.latest().data {
+		if key.Kind == gvk.Kind && key.Group == gvk.Group && key.Namespace == namespace && key.Name == name {
+			return obj
+		}
+	}
+	return Object{}
+}
+
+func names(objs []*unstructured.Unstructured) []string {
+	result := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		result = append(result, obj.GetNamespace()+"/"+obj.GetName())
+	}
+	sort.Strings(result)
+	return result
+}
+
+func listNames(s *Store, gvk schema.GroupVersionKind, namespace string, selector labels.Selector) []string {
+	list := s.List(gvk, namespace, selector).(*unstructured.Unstructured)
+	items, _ := list.Object["items"].([]runtime.Object)
+	objs := make([]*unstructured.Unstructured, 0, len(items))
+	for _, item := range items {
+		objs = append(objs, item.(*unstructured.Unstructured))
+	}
+	return names(objs)
+}
+
+func TestListIndex(t *testing.T) {
+	s := newIndexedStore(1000)
+
+	tests := []struct {
+		name      string
+		namespace string
+		selector  string
+	}{
+		{name: "all"},
+		{name: "namespace", namespace: "ns-4"},
+		{name: "missing namespace", namespace: "missing"},
+		{name: "label", selector: "app=app-8"},
+		{name: "label and namespace", namespace: "ns-8", selector: "app=app-8"},
+		{name: "label in", selector: "app in (app-4, app-12, missing)"},
+		{name: "label exists", selector: "app"},
+		{name: "label not equal", namespace: "ns-0", selector: "app!=app-0"},
+		{name: "missing label value", selector: "app=missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selector, err := labels.Parse(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := names(s.scanList(configMapGVK, tt.namespace, selector))
+			got := listNames(s, configMapGVK, tt.namespace, selector)
+			if fmt.Sprint(got) != fmt.Sprint(expected) {
+				t.Errorf("List returned %d objects %v, expected %d objects %v", len(got), got, len(expected), expected)
+			}
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		s := newIndexedStore(size)
+		name := fmt.Sprintf("obj-%d", size/2)
+		namespace := fmt.Sprintf("ns-%d", (size/2)%10)
+		gvk := schema.GroupVersionKind{Version: "v1", Kind: benchmarkKinds[(size/2)%len(benchmarkKinds)]}
+
+		b.Run(fmt.Sprintf("index/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if s.Get(gvk, namespace, name) == nil {
+					b.Fatal("not found")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("scan/%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if s.scanGet(gvk, namespace, name).Object == nil {
+					b.Fatal("not found")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkList(b *testing.B) {
+	byLabel := labels.SelectorFromSet(labels.Set{"app": "app-8"})
+
+	for _, size := range benchmarkSizes {
+		s := newIndexedStore(size)
+
+		for _, bm := range []struct {
+			name      string
+			namespace string
+			selector  labels.Selector
+		}{
+			{name: "namespace", namespace: "ns-4"},
+			{name: "label", selector: byLabel},
+		} {
+			b.Run(fmt.Sprintf("%s/index/%d", bm.name, size), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					s.List(configMapGVK, bm.namespace, bm.selector)
+				}
+			})
+			b.Run(fmt.Sprintf("%s/scan/%d", bm.name, size), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					s.scanList(configMapGVK, bm.namespace, bm.selector)
+				}
+			})
+		}
+	}
+}
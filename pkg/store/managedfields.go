@@ -0,0 +1,327 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/fieldpath"
+	"sigs.k8s.io/structured-merge-diff/v4/merge"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+)
+
+const (
+	// DefaultFieldManager manages the fields of writes that do not set a field manager
+	DefaultFieldManager = "gitbacked-controller"
+	// DefaultGitFieldManager manages the fields changed by commits that were not written
+	// through the store
+	DefaultGitFieldManager = "git"
+)
+
+type fieldManagerKey struct{}
+
+// WithFieldManager sets the field manager of writes done with the returned context
+func WithFieldManager(ctx context.Context, manager string) context.Context {
+	return context.WithValue(ctx, fieldManagerKey{}, manager)
+}
+
+func (s *Store) fieldManager(ctx context.Context) string {
+	if manager, _ := ctx.Value(fieldManagerKey{}).(string); manager != "" {
+		return manager
+	}
+	return s.defaultFieldManager
+}
+
+// unmanagedFields are never owned by a field manager
+var unmanagedFields = fieldpath.NewSet(
+	fieldpath.MakePathOrDie("apiVersion"),
+	fieldpath.MakePathOrDie("kind"),
+	fieldpath.MakePathOrDie("metadata"),
+	fieldpath.MakePathOrDie("metadata", "name"),
+	fieldpath.MakePathOrDie("metadata", "namespace"),
+)
+
+// storeMetadata is the metadata set by the store, it is removed before fields are compared
+var storeMetadata = []string{
+	"managedFields",
+	"resourceVersion",
+	"uid",
+	"generation",
+	"creationTimestamp",
+	"selfLink",
+	"deletionTimestamp",
+	"deletionGracePeriodSeconds",
+}
+
+// updater tracks the field managers
+var updater = merge.Updater{
+	Converter: versionConverter{},
+}
+
+// versionConverter converts nothing, the fields of every version are assumed to be the same
+type versionConverter struct{}
+
+func (versionConverter) Convert(object *typed.TypedValue, _ fieldpath.APIVersion) (*typed.TypedValue, error) {
+	return object, nil
+}
+
+func (versionConverter) IsMissingVersionError(error) bool {
+	return false
+}
+
+// typeOf returns the type of the objects of gvk, deduced from their content if there is
+// no schema
+func (s *Store) typeOf(gvk schema.GroupVersionKind) typed.ParseableType {
+	if s.objectType != nil {
+		if objectType, ok := s.objectType(gvk); ok {
+			return objectType
+		}
+	}
+	return typed.DeducedParseableType
+}
+
+func toTyped(objectType typed.ParseableType, obj *unstructured.Unstructured) (*typed.TypedValue, error) {
+	if obj == nil {
+		return objectType.FromUnstructured(map[string]interface{}{})
+	}
+	obj = obj.DeepCopy()
+	for _, field := range storeMetadata {
+		unstructured.RemoveNestedField(obj.Object, "metadata", field)
+	}
+	return objectType.FromUnstructured(obj.Object)
+}
+
+// typedValues converts live and obj to objectType. If live, which was read from git, does not
+// match the type both are deduced from their content, obj not matching is a bad request.
+func typedValues(objectType typed.ParseableType, live, obj *unstructured.Unstructured) (*typed.TypedValue, *typed.TypedValue, error) {
+	liveValue, err := toTyped(objectType, live)
+	if err != nil {
+		logrus.Warnf("%s %s does not match its schema, deducing its fields from its content: %v",
+			live.GetKind(), live.GetName(), err)
+		objectType = typed.DeducedParseableType
+		if liveValue, err = toTyped(objectType, live); err != nil {
+			return nil, nil, err
+		}
+	}
+	value, err := toTyped(objectType, obj)
+	if err != nil {
+		return nil, nil, apierrors.NewBadRequest(err.Error())
+	}
+	return liveValue, value, nil
+}
+
+// updateManagedFields returns the managedFields of obj after manager changed live to obj. live
+// is nil for a new object.
+func updateManagedFields(objectType typed.ParseableType, live, obj *unstructured.Unstructured, entries []metav1.ManagedFieldsEntry, manager string, now metav1.Time) ([]metav1.ManagedFieldsEntry, error) {
+	managed, err := decodeManagedFields(entries)
+	if err != nil {
+		return nil, err
+	}
+	liveValue, newValue, err := typedValues(objectType, live, obj)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := managerIdentifier(manager, metav1.ManagedFieldsOperationUpdate, obj.GetAPIVersion())
+	if err != nil {
+		return nil, err
+	}
+	_, managed, err = updater.Update(liveValue, newValue, fieldpath.APIVersion(obj.GetAPIVersion()), managed, id)
+	if err != nil {
+		return nil, err
+	}
+	return encodeManagedFields(managed, entries, now)
+}
+
+// applyManagedFields merges config into live as manager and returns the result and its
+// managedFields. The result is nil if the object did not change. Fields owned by other
+// managers are only changed if force is set, otherwise a conflict is returned.
+func applyManagedFields(objectType typed.ParseableType, live, config *unstructured.Unstructured, entries []metav1.ManagedFieldsEntry, manager string, force bool, now metav1.Time) (*unstructured.Unstructured, []metav1.ManagedFieldsEntry, error) {
+	managed, err := decodeManagedFields(entries)
+	if err != nil {
+		return nil, nil, err
+	}
+	liveValue, configValue, err := typedValues(objectType, live, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := managerIdentifier(manager, metav1.ManagedFieldsOperationApply, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	newValue, managed, err := updater.Apply(liveValue, configValue, fieldpath.APIVersion(config.GetAPIVersion()), managed, id, force)
+	if err != nil {
+		var conflicts merge.Conflicts
+		if errors.As(err, &conflicts) {
+			return nil, nil, conflictError(conflicts)
+		}
+		return nil, nil, apierrors.NewBadRequest(err.Error())
+	}
+
+	entries, err = encodeManagedFields(managed, entries, now)
+	if err != nil || newValue == nil {
+		return nil, entries, err
+	}
+
+	content, ok := newValue.AsValue().Unstructured().(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("applied object is not a map")
+	}
+	return &unstructured.Unstructured{
+		Object: content,
+	}, entries, nil
+}
+
+// managerIdentifier is the key of a manager in fieldpath.ManagedFields. Like the apiserver the
+// version of an update is part of the key so the fields of every version are kept.
+func managerIdentifier(manager string, operation metav1.ManagedFieldsOperationType, apiVersion string) (string, error) {
+	entry := metav1.ManagedFieldsEntry{
+		Manager:   manager,
+		Operation: operation,
+	}
+	if operation == metav1.ManagedFieldsOperationUpdate {
+		entry.APIVersion = apiVersion
+	}
+	id, err := json.Marshal(entry)
+	return string(id), err
+}
+
+func decodeManagedFields(entries []metav1.ManagedFieldsEntry) (fieldpath.ManagedFields, error) {
+	managed := fieldpath.ManagedFields{}
+	for _, entry := range entries {
+		id, err := managerIdentifier(entry.Manager, entry.Operation, entry.APIVersion)
+		if err != nil {
+			return nil, err
+		}
+		set := &fieldpath.Set{}
+		if entry.FieldsV1 != nil {
+			if err := set.FromJSON(strings.NewReader(string(entry.FieldsV1.Raw))); err != nil {
+				return nil, fmt.Errorf("invalid managedFields of %s: %w", entry.Manager, err)
+			}
+		}
+		managed[id] = fieldpath.NewVersionedSet(set, fieldpath.APIVersion(entry.APIVersion),
+			entry.Operation == metav1.ManagedFieldsOperationApply)
+	}
+	return managed, nil
+}
+
+// encodeManagedFields converts managed to managedFields entries. The time of an entry is the
+// last time the fields of the manager changed.
+func encodeManagedFields(managed fieldpath.ManagedFields, previous []metav1.ManagedFieldsEntry, now metav1.Time) ([]metav1.ManagedFieldsEntry, error) {
+	previousEntries := map[string]metav1.ManagedFieldsEntry{}
+	for _, entry := range previous {
+		id, err := managerIdentifier(entry.Manager, entry.Operation, entry.APIVersion)
+		if err != nil {
+			return nil, err
+		}
+		previousEntries[id] = entry
+	}
+
+	var entries []metav1.ManagedFieldsEntry
+	for id, versioned := range managed {
+		set := versioned.Set().Difference(unmanagedFields)
+		if set.Empty() {
+			continue
+		}
+		fields, err := set.ToJSON()
+		if err != nil {
+			return nil, err
+		}
+
+		entry := metav1.ManagedFieldsEntry{}
+		if err := json.Unmarshal([]byte(id), &entry); err != nil {
+			return nil, err
+		}
+		entry.APIVersion = string(versioned.APIVersion())
+		entry.FieldsType = "FieldsV1"
+		entry.FieldsV1 = &metav1.FieldsV1{Raw: fields}
+		entry.Time = &now
+		if last, ok := previousEntries[id]; ok && last.Time != nil && last.FieldsV1 != nil &&
+			bytes.Equal(last.FieldsV1.Raw, fields) {
+			entry.Time = last.Time
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Time.Equal(entries[j].Time) {
+			return entries[i].Time.Before(entries[j].Time)
+		}
+		if entries[i].Manager != entries[j].Manager {
+			return entries[i].Manager < entries[j].Manager
+		}
+		return entries[i].Operation < entries[j].Operation
+	})
+	return entries, nil
+}
+
+func conflictError(conflicts merge.Conflicts) error {
+	causes := make([]metav1.StatusCause, 0, len(conflicts))
+	for _, conflict := range conflicts {
+		entry := metav1.ManagedFieldsEntry{}
+		if err := json.Unmarshal([]byte(conflict.Manager), &entry); err != nil {
+			entry.Manager = conflict.Manager
+		}
+		causes = append(causes, metav1.StatusCause{
+			Type:    metav1.CauseTypeFieldManagerConflict,
+			Message: fmt.Sprintf("conflict with %q", entry.Manager),
+			Field:   conflict.Path.String(),
+		})
+	}
+
+	messages := make([]string, 0, len(causes))
+	for _, cause := range causes {
+		messages = append(messages, fmt.Sprintf("%s: %s", cause.Message, cause.Field))
+	}
+	return apierrors.NewApplyConflict(causes, fmt.Sprintf("Apply failed with %d conflicts: %s",
+		len(causes), strings.Join(messages, ", ")))
+}
+
+// trackManagedFields sets the managedFields of an object read from git. Writes through the store
+// recorded their managers when they were staged, other changes are owned by the git field
+// manager. previous is nil for a new object.
+func (s *Store) trackManagedFields(obj *Object, previous *Object, now metav1.Time) {
+	if obj.Path == "" {
+		// synthetic objects have no managers
+		return
+	}
+	if entries, ok := s.written[obj.ObjectKey]; ok {
+		obj.ManagedFields = entries
+		return
+	}
+
+	entries := obj.Object.GetManagedFields()
+	if previous == nil && len(entries) > 0 {
+		// persisted in git
+		obj.ManagedFields = entries
+		return
+	}
+
+	var live *unstructured.Unstructured
+	if previous != nil {
+		live = previous.Object
+		if len(entries) == 0 {
+			entries = previous.ManagedFields
+		}
+	}
+	updated, err := updateManagedFields(s.typeOf(obj.Object.GroupVersionKind()), live, obj.Object, entries, s.gitFieldManager, now)
+	if err != nil {
+		// edits in git are not validated, track them like objects without a schema
+		updated, err = updateManagedFields(typed.DeducedParseableType, live, obj.Object, entries, s.gitFieldManager, now)
+	}
+	if err != nil {
+		logrus.Warnf("Failed to track managed fields of %s %s: %v", obj.Kind, objectName(obj.ObjectKey), err)
+		updated = entries
+	}
+	obj.ManagedFields = updated
+}
@@ -0,0 +1,279 @@
+package store
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/mapping"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
+	"sigs.k8s.io/yaml"
+)
+
+const widgetCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  scope: Namespaced
+  names:
+    kind: Widget
+    plural: widgets
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              ports:
+                type: array
+                x-kubernetes-list-type: map
+                x-kubernetes-list-map-keys:
+                - port
+                - protocol
+                items:
+                  type: object
+                  properties:
+                    port:
+                      type: integer
+                    protocol:
+                      type: string
+                    name:
+                      type: string
+`
+
+func toObject(t *testing.T, content string) *unstructured.Unstructured {
+	t.Helper()
+
+	obj := &unstructured.Unstructured{}
+	if err := yaml.Unmarshal([]byte(content), &obj.Object); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+// objectType returns the type of gvk built by a mapper from the core scheme and crds
+func objectType(t *testing.T, gvk schema.GroupVersionKind, crds ...string) typed.ParseableType {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	mapper := mapping.New(nil)
+	mapper.AddScheme(scheme)
+	var objs []runtime.Object
+	for _, crd := range crds {
+		objs = append(objs, toObject(t, crd))
+	}
+	mapper.SetCRDs(objs)
+
+	objectType, ok := mapper.ObjectType(gvk)
+	if !ok {
+		t.Fatalf("no type for %s", gvk)
+	}
+	return objectType
+}
+
+// applier applies configurations to an object like the store does
+type applier struct {
+	t          *testing.T
+	objectType typed.ParseableType
+	live       *unstructured.Unstructured
+	entries    []metav1.ManagedFieldsEntry
+}
+
+func (a *applier) apply(manager string, force bool, config string) error {
+	a.t.Helper()
+
+	applied, entries, err := applyManagedFields(a.objectType, a.live, toObject(a.t, config), a.entries, manager, force, metav1.Now())
+	if err != nil {
+		return err
+	}
+	if applied != nil {
+		a.live = applied
+	}
+	a.entries = entries
+	return nil
+}
+
+// fields returns the managed fields of manager
+func (a *applier) fields(manager string) string {
+	for _, entry := range a.entries {
+		if entry.Manager == manager {
+			return string(entry.FieldsV1.Raw)
+		}
+	}
+	return ""
+}
+
+// names returns the value of field of every item in the list at path
+func (a *applier) names(field string, path ...string) []string {
+	a.t.Helper()
+
+	items, _, err := unstructured.NestedSlice(a.live.Object, path...)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	var names []string
+	for _, item := range items {
+		names = append(names, item.(map[string]interface{})[field].(string))
+	}
+	return names
+}
+
+const (
+	podA = `apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+  namespace: ns
+  labels:
+    a: a
+spec:
+  containers:
+  - name: a
+    image: a:1
+`
+	podB = `apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+  namespace: ns
+spec:
+  containers:
+  - name: b
+    image: b:1
+`
+	podAImage = `apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+  namespace: ns
+spec:
+  containers:
+  - name: a
+    image: a:2
+`
+	podNoContainers = `apiVersion: v1
+kind: Pod
+metadata:
+  name: pod
+  namespace: ns
+`
+)
+
+func TestApplyFieldOwnership(t *testing.T) {
+	a := &applier{t: t, objectType: objectType(t, corev1.SchemeGroupVersion.WithKind("Pod"))}
+	if err := a.apply("a", false, podA); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := a.fields("a")
+	for _, field := range []string{`"f:labels":{"f:a":{}}`, `"k:{\"name\":\"a\"}":{`, `"f:image":{}`} {
+		if !strings.Contains(fields, field) {
+			t.Errorf("fields of a %s do not have %s", fields, field)
+		}
+	}
+}
+
+func TestApplyConflict(t *testing.T) {
+	a := &applier{t: t, objectType: objectType(t, corev1.SchemeGroupVersion.WithKind("Pod"))}
+	if err := a.apply("a", false, podA); err != nil {
+		t.Fatal(err)
+	}
+
+	err := a.apply("b", false, podAImage)
+	if !apierrors.IsConflict(err) {
+		t.Fatalf("expected a conflict, got %v", err)
+	}
+	causes := err.(apierrors.APIStatus).Status().Details.Causes
+	if len(causes) != 1 || causes[0].Field != `.spec.containers[name="a"].image` {
+		t.Errorf("unexpected causes %v", causes)
+	}
+	if image, _, _ := unstructured.NestedSlice(a.live.Object, "spec", "containers"); image[0].(map[string]interface{})["image"] != "a:1" {
+		t.Errorf("conflicting apply changed the object to %v", image)
+	}
+}
+
+func TestApplyForce(t *testing.T) {
+	a := &applier{t: t, objectType: objectType(t, corev1.SchemeGroupVersion.WithKind("Pod"))}
+	if err := a.apply("a", false, podA); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.apply("b", true, podAImage); err != nil {
+		t.Fatal(err)
+	}
+
+	containers, _, _ := unstructured.NestedSlice(a.live.Object, "spec", "containers")
+	if image := containers[0].(map[string]interface{})["image"]; image != "a:2" {
+		t.Errorf("image is %v, expected a:2", image)
+	}
+	if strings.Contains(a.fields("a"), `"f:image"`) {
+		t.Errorf("a still owns the image: %s", a.fields("a"))
+	}
+	if !strings.Contains(a.fields("b"), `"f:image"`) {
+		t.Errorf("b does not own the image: %s", a.fields("b"))
+	}
+}
+
+func TestApplyListEntries(t *testing.T) {
+	a := &applier{t: t, objectType: objectType(t, corev1.SchemeGroupVersion.WithKind("Pod"))}
+	if err := a.apply("a", false, podA); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.apply("b", false, podB); err != nil {
+		t.Fatal(err)
+	}
+	if names := a.names("name", "spec", "containers"); strings.Join(names, ",") != "a,b" {
+		t.Fatalf("containers are %v, expected a and b", names)
+	}
+
+	// a no longer applies its container, only the container of b is kept
+	if err := a.apply("a", false, podNoContainers); err != nil {
+		t.Fatal(err)
+	}
+	if names := a.names("name", "spec", "containers"); strings.Join(names, ",") != "b" {
+		t.Errorf("containers are %v, expected b", names)
+	}
+}
+
+func TestApplyCRDListEntries(t *testing.T) {
+	gvk := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+	a := &applier{t: t, objectType: objectType(t, gvk, widgetCRD)}
+	widget := `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+  namespace: ns
+spec:
+  ports:
+  - port: 80
+    protocol: %s
+    name: %s
+`
+	if err := a.apply("a", false, strings.Replace(strings.Replace(widget, "%s", "TCP", 1), "%s", "a", 1)); err != nil {
+		t.Fatal(err)
+	}
+	// the same port with another protocol is another entry
+	if err := a.apply("b", false, strings.Replace(strings.Replace(widget, "%s", "UDP", 1), "%s", "b", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if names := a.names("name", "spec", "ports"); strings.Join(names, ",") != "a,b" {
+		t.Errorf("ports are %v, expected a and b", names)
+	}
+	if fields := a.fields("b"); !strings.Contains(fields, `"k:{\"port\":80,\"protocol\":\"UDP\"}"`) {
+		t.Errorf("b does not own its port: %s", fields)
+	}
+}
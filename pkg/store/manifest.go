@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/manifest"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// read parses the objects in file, skipping documents that are not valid objects. The
+// problems found are returned for the repository status. Nothing is returned if the file does
+// not exist.
+func (s *Store) read(file string) ([]Object, []string) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		logrus.Errorf("Failed to read %s, skipping: %v", file, err)
+		return nil, []string{err.Error()}
+	}
+
+	format, _ := manifest.FormatFor(file)
+	docs, err := manifest.Parse(format, data)
+	if err != nil {
+		logrus.Errorf("Failed to unmarshal %s, skipping: %v", file, err)
+		return nil, []string{err.Error()}
+	}
+
+	var (
+		result   []Object
+		problems []string
+	)
+	for _, doc := range docs {
+		unstr := &unstructured.Unstructured{
+			Object: doc.Object,
+		}
+		gvk := unstr.GroupVersionKind()
+
+		obj := Object{
+			ObjectKey: ObjectKey{
+				Kind:      gvk.Kind,
+				Group:     gvk.Group,
+				Name:      unstr.GetName(),
+				Namespace: unstr.GetNamespace(),
+			},
+			Version:  gvk.Version,
+			UID:      unstr.GetUID(),
+			Content:  doc.Content,
+			Object:   unstr,
+			Path:     file,
+			Document: doc.Index,
+			Item:     doc.Item,
+		}
+		if obj.Kind == "" ||
+			obj.Name == "" ||
+			obj.Version == "" {
+			problem := documentProblem(doc, "apiVersion, kind and metadata.name are required")
+			logrus.Warnf("Skipping object in %s, %s", file, problem)
+			problems = append(problems, problem)
+			continue
+		}
+		if obj.UID == "" {
+			obj.UID = deriveUID(obj.ObjectKey)
+		}
+		result = append(result, obj)
+	}
+	return result, problems
+}
+
+// matchKey selects the document of key in a file. The document is looked up every time the
+// file is written because other writes in the same batch can move it.
+func matchKey(key ObjectKey) manifest.Match {
+	return func(obj map[string]interface{}) bool {
+		unstr := &unstructured.Unstructured{
+			Object: obj,
+		}
+		gvk := unstr.GroupVersionKind()
+		return gvk.Group == key.Group &&
+			gvk.Kind == key.Kind &&
+			unstr.GetNamespace() == key.Namespace &&
+			unstr.GetName() == key.Name
+	}
+}
+
+// writeObject writes obj to path, replacing only its own document if path already has it
+// and adding it to the end of the file otherwise
+func (s *Store) writeObject(ctx context.Context, key ObjectKey, path string, obj runtime.Object) error {
+	_, data, err := s.render(key, path, obj)
+	if err != nil {
+		return err
+	}
+	return s.repo.Write(ctx, path, data)
+}
+
+// render returns the current content of path, nil if it does not exist, and the content with
+// obj written to it
+func (s *Store) render(key ObjectKey, path string, obj runtime.Object) ([]byte, []byte, error) {
+	format, _ := manifest.FormatFor(path)
+	existing, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		data, err := manifest.Marshal(format, obj)
+		return nil, data, err
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := manifest.Update(format, existing, matchKey(key), obj)
+	if err == manifest.ErrNotFound {
+		// a new object in a file that has other objects
+		data, err = manifest.Append(format, existing, obj)
+	}
+	return existing, data, err
+}
+
+// removeObject removes the document of key from path, the file is removed if no other
+// objects are left in it
+func (s *Store) removeObject(ctx context.Context, key ObjectKey, path string) error {
+	existing, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	format, _ := manifest.FormatFor(path)
+	data, err := manifest.Delete(format, existing, matchKey(key))
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return s.repo.Remove(ctx, path)
+	}
+	return s.repo.Write(ctx, path, data)
+}
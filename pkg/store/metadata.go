@@ -0,0 +1,138 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DefaultPersistMetadata is the metadata fields that are not written to git unless enabled in
+// Options.PersistMetadata. They are managed by the store and set again when objects are read.
+// Fields that are not listed are always written. New objects get a random uid that is written
+// to git, without it the uid is derived from the identity of the object.
+var DefaultPersistMetadata = map[string]bool{
+	"resourceVersion":   false,
+	"uid":               true,
+	"generation":        false,
+	"creationTimestamp": false,
+	"managedFields":     false,
+	"selfLink":          false,
+}
+
+func persistMetadata(overrides map[string]bool) map[string]bool {
+	result := map[string]bool{}
+	for field, persist := range DefaultPersistMetadata {
+		result[field] = persist
+	}
+	for field, persist := range overrides {
+		result[field] = persist
+	}
+	return result
+}
+
+func (s *Store) persisted(field string) bool {
+	persist, ok := s.persistMetadata[field]
+	return !ok || persist
+}
+
+// normalize sets the metadata managed by the store on obj and removes the fields that are not
+// persisted. found is the stored object, empty for a new object. Only a delete can set the
+// deletionTimestamp.
+func (s *Store) normalize(obj *unstructured.Unstructured, found Object, op Operation) {
+	key := keyFor(obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+	if op != OperationDelete {
+		var (
+			deletionTimestamp   *metav1.Time
+			deletionGracePeriod *int64
+		)
+		if found.Object != nil {
+			deletionTimestamp = found.Object.GetDeletionTimestamp()
+			deletionGracePeriod = found.Object.GetDeletionGracePeriodSeconds()
+		}
+		obj.SetDeletionTimestamp(deletionTimestamp)
+		obj.SetDeletionGracePeriodSeconds(deletionGracePeriod)
+	}
+	if found.Object == nil {
+		obj.SetUID(s.newUID(key))
+		obj.SetCreationTimestamp(metav1.Now())
+		obj.SetGeneration(1)
+	} else {
+		obj.SetUID(found.UID)
+		obj.SetCreationTimestamp(found.CreationTimestamp)
+		obj.SetGeneration(nextGeneration(found, obj))
+	}
+
+	metadata, _ := obj.Object["metadata"].(map[string]interface{})
+	for field, value := range metadata {
+		if field == "uid" {
+			// only a UID that can't be derived again has to be in git
+			if value == string(deriveUID(key)) {
+				delete(metadata, field)
+			}
+			continue
+		}
+		if !s.persisted(field) {
+			delete(metadata, field)
+		}
+	}
+}
+
+// newUID returns the UID of a new object, random unless the uid is not persisted
+func (s *Store) newUID(key ObjectKey) types.UID {
+	if !s.persisted("uid") {
+		return deriveUID(key)
+	}
+	return types.UID(uuid.New().String())
+}
+
+// hydrate sets the metadata of an object read from git that is not in the file, carrying it
+// over from the previous version of the object
+func hydrate(obj *Object, previous *Object, now metav1.Time) {
+	obj.Generation = obj.Object.GetGeneration()
+	if obj.Generation == 0 {
+		obj.Generation = 1
+		if previous != nil {
+			obj.Generation = nextGeneration(*previous, obj.Object)
+		}
+	}
+
+	obj.CreationTimestamp = obj.Object.GetCreationTimestamp()
+	if obj.CreationTimestamp.IsZero() {
+		obj.CreationTimestamp = now
+		if previous != nil {
+			obj.CreationTimestamp = previous.CreationTimestamp
+		}
+	}
+}
+
+// nextGeneration returns the generation of obj, it is only incremented if something other
+// than the metadata and status changed or the deletionTimestamp was set
+func nextGeneration(previous Object, obj *unstructured.Unstructured) int64 {
+	if previous.Object.GetDeletionTimestamp() == nil && obj.GetDeletionTimestamp() != nil {
+		return previous.Generation + 1
+	}
+	// compared as JSON because numbers are int64 or float64 depending on the decoder
+	before, err := json.Marshal(withoutMetadata(previous.Object.Object))
+	if err != nil {
+		return previous.Generation + 1
+	}
+	after, err := json.Marshal(withoutMetadata(obj.Object))
+	if err != nil || !bytes.Equal(before, after) {
+		return previous.Generation + 1
+	}
+	return previous.Generation
+}
+
+func withoutMetadata(obj map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		if k != "metadata" && k != "status" {
+			result[k] = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNormalizeUID(t *testing.T) {
+	newObj := func() *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("ConfigMap")
+		obj.SetNamespace("ns")
+		obj.SetName("a")
+		return obj
+	}
+	key := ObjectKey{Kind: "ConfigMap", Namespace: "ns", Name: "a"}
+	derived := deriveUID(key)
+
+	s := &Store{persistMetadata: persistMetadata(nil)}
+
+	created := newObj()
+	s.normalize(created, Object{}, OperationCreate)
+	if created.GetUID() == "" || created.GetUID() == derived {
+		t.Errorf("expected a random uid for a new object, got %q", created.GetUID())
+	}
+
+	recreated := newObj()
+	s.normalize(recreated, Object{}, OperationCreate)
+	if recreated.GetUID() == created.GetUID() {
+		t.Errorf("expected a new uid for a recreated object, got %q again", recreated.GetUID())
+	}
+
+	updated := newObj()
+	s.normalize(updated, Object{ObjectKey: key, UID: created.GetUID(), Object: created}, OperationUpdate)
+	if updated.GetUID() != created.GetUID() {
+		t.Errorf("expected the uid %q to be kept, got %q", created.GetUID(), updated.GetUID())
+	}
+
+	handWritten := newObj()
+	s.normalize(handWritten, Object{ObjectKey: key, UID: derived, Object: newObj()}, OperationUpdate)
+	if handWritten.GetUID() != "" {
+		t.Errorf("expected the derived uid to be left out of git, got %q", handWritten.GetUID())
+	}
+
+	s = &Store{persistMetadata: persistMetadata(map[string]bool{"uid": false})}
+	notPersisted := newObj()
+	s.normalize(notPersisted, Object{}, OperationCreate)
+	if notPersisted.GetUID() != "" {
+		t.Errorf("expected the derived uid of a new object to be left out of git, got %q", notPersisted.GetUID())
+	}
+}
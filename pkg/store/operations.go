@@ -1,11 +1,12 @@
 package store
 
 import (
+	"bytes"
 	"context"
 	"fmt"
-	"path/filepath"
 	"strconv"
 
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -15,44 +16,50 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/rand"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/yaml"
 )
 
 func (s *Store) Get(gvk schema.GroupVersionKind, namespace, name string) client.Object {
 	s.contentLock.RLock()
 	defer s.contentLock.RUnlock()
-	return s.get(gvk, namespace, name).Object
+	obj := s.get(gvk, namespace, name)
+	if obj.Object == nil {
+		// avoid returning a typed nil
+		return nil
+	}
+	return obj.Object
 }
 
-func (s *Store) get(gvk schema.GroupVersionKind, namespace, name string) Object {
-	index := len(s.revisions) - 1
-	rev := s.revisions[index]
-	for key, obj := range rev.data {
-		if key.Kind == gvk.Kind &&
-			key.Group == gvk.Group &&
-			key.Namespace == namespace &&
-			key.Name == name {
-			return obj
-		}
+func keyFor(gvk schema.GroupVersionKind, namespace, name string) ObjectKey {
+	return ObjectKey{
+		Kind:      gvk.Kind,
+		Group:     gvk.Group,
+		Name:      name,
+		Namespace: namespace,
 	}
+}
 
-	return Object{}
+func (s *Store) get(gvk schema.GroupVersionKind, namespace, name string) Object {
+	return s.latest().data[keyFor(gvk, namespace, name)]
 }
 
 func (s *Store) List(gvk schema.GroupVersionKind, namespace string, selector labels.Selector) runtime.Object {
 	s.contentLock.RLock()
 	defer s.contentLock.RUnlock()
 
-	var items []runtime.Object
-
-	index := len(s.revisions) - 1
-	rev := s.revisions[index]
-	for key, obj := range rev.data {
-		if key.Kind == gvk.Kind &&
-			key.Group == gvk.Group &&
-			(namespace == "" || obj.Namespace == namespace) &&
-			(selector == nil || selector.Matches(labels.Set(obj.Object.GetLabels()))) {
-			items = append(items, obj.Object)
+	var (
+		items []runtime.Object
+		rev   = s.latest()
+		gk    = gvk.GroupKind()
+	)
+
+	if rev.index != nil {
+		for _, keys := range rev.index.candidates(gk, namespace, selector) {
+			for key := range keys {
+				obj := rev.data[key]
+				if selected(obj, namespace, selector) {
+					items = append(items, obj.Object)
+				}
+			}
 		}
 	}
 
@@ -61,15 +68,33 @@ func (s *Store) List(gvk schema.GroupVersionKind, namespace string, selector lab
 			"kind":  gvk.Kind + "List",
 			"items": items,
 			"metadata": map[string]interface{}{
-				"resourceVersion": strconv.Itoa(index),
+				"resourceVersion": strconv.Itoa(rev.version),
 			},
 		},
 	}
 }
 
+// selected returns true if obj is in namespace, or namespace is empty, and matches selector
+func selected(obj Object, namespace string, selector labels.Selector) bool {
+	return (namespace == "" || obj.Namespace == namespace) &&
+		(selector == nil || selector.Matches(labels.Set(obj.Object.GetLabels())))
+}
+
 func (s *Store) Create(ctx context.Context, gvk schema.GroupVersionKind, object client.Object) (runtime.Object, error) {
 	s.contentLock.Lock()
-	defer s.contentLock.Unlock()
+	w, err := s.create(ctx, gvk, object)
+	s.contentLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.wait(w)
+}
+
+func (s *Store) create(ctx context.Context, gvk schema.GroupVersionKind, object client.Object) (*pendingWrite, error) {
+	if err := readOnly(gvk, "create"); err != nil {
+		return nil, err
+	}
 
 	name := object.GetName()
 	namespace := object.GetNamespace()
@@ -82,7 +107,7 @@ func (s *Store) Create(ctx context.Context, gvk schema.GroupVersionKind, object
 		for {
 			testName := fmt.Sprintf("%s%s", prefix, rand.String(4))
 			existing := s.get(gvk, namespace, testName)
-			if existing.Object == nil {
+			if existing.Object == nil && !s.pending(keyFor(gvk, namespace, testName)) {
 				name = testName
 				object = object.DeepCopyObject().(client.Object)
 				object.SetName(name)
@@ -91,6 +116,10 @@ func (s *Store) Create(ctx context.Context, gvk schema.GroupVersionKind, object
 		}
 	}
 
+	if err := s.flushPending(keyFor(gvk, namespace, name)); err != nil {
+		return nil, err
+	}
+
 	existing := s.get(gvk, namespace, name)
 	if existing.Object != nil {
 		return nil, errors.NewAlreadyExists(schema.GroupResource{
@@ -99,83 +128,169 @@ func (s *Store) Create(ctx context.Context, gvk schema.GroupVersionKind, object
 		}, name)
 	}
 
-	file := filepath.Join(s.repo.Dir, s.subDir, gvk.Group, gvk.Version, gvk.Kind, namespace, name) + ".yaml"
-	return s.save(ctx, gvk, object, file, true)
+	file, err := s.newPath(gvk, namespace, name, object.GetLabels(), object.GetAnnotations())
+	if err != nil {
+		return nil, err
+	}
+	return s.save(ctx, gvk, object, Object{}, file, OperationCreate)
 }
 
-func (s *Store) save(ctx context.Context, gvk schema.GroupVersionKind, object client.Object, path string, generation bool) (runtime.Object, error) {
-	cloned := object.DeepCopyObject()
-	t, err := meta.TypeAccessor(cloned)
+// save writes object to path, found is the stored object or empty for a new object
+func (s *Store) save(ctx context.Context, gvk schema.GroupVersionKind, object client.Object, found Object, path string, op Operation) (*pendingWrite, error) {
+	cloned, err := toUnstructured(object)
 	if err != nil {
 		return nil, err
 	}
-	apiVersion, kind := gvk.ToAPIVersionAndKind()
-	t.SetKind(kind)
-	t.SetAPIVersion(apiVersion)
+	cloned.SetGroupVersionKind(gvk)
 
-	if generation {
-		meta, err := meta.Accessor(cloned)
+	managedFields, err := updateManagedFields(s.typeOf(gvk), found.Object, cloned, found.ManagedFields, s.fieldManager(ctx), metav1.Now())
+	if err != nil {
+		return nil, err
+	}
+	return s.write(ctx, gvk, cloned, found, path, op, managedFields)
+}
+
+// write stages writing obj with managedFields to path. If the file would not change the
+// write is done without a commit.
+func (s *Store) write(ctx context.Context, gvk schema.GroupVersionKind, obj *unstructured.Unstructured, found Object, path string, op Operation,
+	managedFields []metav1.ManagedFieldsEntry) (*pendingWrite, error) {
+	obj.SetManagedFields(managedFields)
+	s.normalize(obj, found, op)
+
+	message, err := s.commitMessage(ctx, CommitInfo{
+		GroupVersionKind: gvk,
+		Operation:        op,
+		Namespace:        obj.GetNamespace(),
+		Name:             obj.GetName(),
+		Generation:       obj.GetGeneration(),
+		FieldManager:     s.fieldManager(ctx),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	key := keyFor(gvk, obj.GetNamespace(), obj.GetName())
+	if found.Object != nil {
+		existing, data, err := s.render(key, path, obj)
 		if err != nil {
 			return nil, err
 		}
-
-		meta.SetGeneration(meta.GetGeneration() + 1)
+		if bytes.Equal(existing, data) {
+			// nothing to commit
+			if !equality.Semantic.DeepEqual(found.ManagedFields, managedFields) {
+				found = s.setManagedFields(found, managedFields)
+			}
+			return completed(found), nil
+		}
 	}
 
-	data, err := yaml.Marshal(cloned)
+	return s.stage(ctx, key, message, managedFields, func() error {
+		return s.writeObject(ctx, key, path, obj)
+	})
+}
+
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj.DeepCopyObject())
 	if err != nil {
 		return nil, err
 	}
+	return &unstructured.Unstructured{
+		Object: data,
+	}, nil
+}
 
-	if err := s.repo.Add(ctx, path, data); err != nil {
-		return nil, err
+// Delete removes the object. With garbage collection enabled propagation can be foreground or
+// orphan, the default is background.
+func (s *Store) Delete(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, preconditions *metav1.Preconditions, propagation *metav1.DeletionPropagation) error {
+	s.contentLock.Lock()
+	w, err := s.delete(ctx, gvk, namespace, name, preconditions, propagation)
+	s.contentLock.Unlock()
+	if err != nil || w == nil {
+		return err
 	}
 
-	if err := s.scanAndUpdate(); err != nil {
+	_, err = s.wait(w)
+	return err
+}
+
+func (s *Store) delete(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, preconditions *metav1.Preconditions, propagation *metav1.DeletionPropagation) (*pendingWrite, error) {
+	if err := readOnly(gvk, "delete"); err != nil {
 		return nil, err
 	}
 
-	return s.get(gvk, object.GetNamespace(), object.GetName()).Object, nil
-}
-
-func (s *Store) Delete(ctx context.Context, gvk schema.GroupVersionKind, namespace, name string, preconditions *metav1.Preconditions) error {
-	s.contentLock.RLock()
-	defer s.contentLock.RUnlock()
+	if err := s.flushPending(keyFor(gvk, namespace, name)); err != nil {
+		return nil, err
+	}
 
 	found := s.get(gvk, namespace, name)
 	if found.Object == nil {
-		return nil
+		return nil, nil
 	}
 
 	meta, err := meta.Accessor(found.Object)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if preconditions != nil && preconditions.ResourceVersion != nil && meta.GetResourceVersion() != *preconditions.ResourceVersion {
-		return errors.NewConflict(schema.GroupResource{
+		return nil, errors.NewConflict(schema.GroupResource{
 			Group:    gvk.Group,
 			Resource: gvk.Kind,
 		}, name, fmt.Errorf("resourceVersion %s does not match requested %s", meta.GetResourceVersion(), *preconditions.ResourceVersion))
 	}
 
 	if preconditions != nil && preconditions.UID != nil && meta.GetUID() != *preconditions.UID {
-		return errors.NewConflict(schema.GroupResource{
+		return nil, errors.NewConflict(schema.GroupResource{
 			Group:    gvk.Group,
 			Resource: gvk.Kind,
 		}, name, fmt.Errorf("uid %s does not match requested %s", meta.GetUID(), *preconditions.UID))
 	}
 
-	if err := s.repo.Delete(ctx, found.Path); err != nil {
-		return err
+	finalizer := s.propagationFinalizer(propagation)
+	if len(meta.GetFinalizers()) > 0 || finalizer != "" {
+		return s.markDeleted(ctx, gvk, found, finalizer)
+	}
+	return s.remove(ctx, gvk, found)
+}
+
+// remove stages the removal of the object from its file
+func (s *Store) remove(ctx context.Context, gvk schema.GroupVersionKind, found Object) (*pendingWrite, error) {
+	message, err := s.commitMessage(ctx, CommitInfo{
+		GroupVersionKind: gvk,
+		Operation:        OperationDelete,
+		Namespace:        found.Namespace,
+		Name:             found.Name,
+		Generation:       found.Generation,
+		FieldManager:     s.fieldManager(ctx),
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return s.scanAndUpdate()
+	return s.stage(ctx, found.ObjectKey, message, nil, func() error {
+		return s.removeObject(ctx, found.ObjectKey, found.Path)
+	})
 }
 
 func (s *Store) Update(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object, generation bool) (runtime.Object, error) {
-	s.contentLock.RLock()
-	defer s.contentLock.RUnlock()
+	s.contentLock.Lock()
+	w, err := s.update(ctx, gvk, obj, generation)
+	s.contentLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.wait(w)
+}
+
+func (s *Store) update(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object, generation bool) (*pendingWrite, error) {
+	if err := readOnly(gvk, "update"); err != nil {
+		return nil, err
+	}
+
+	if err := s.flushPending(keyFor(gvk, obj.GetNamespace(), obj.GetName())); err != nil {
+		return nil, err
+	}
 
 	found := s.get(gvk, obj.GetNamespace(), obj.GetName())
 	if found.Object == nil {
@@ -192,5 +307,19 @@ func (s *Store) Update(ctx context.Context, gvk schema.GroupVersionKind, obj cli
 		}, obj.GetName(), fmt.Errorf("resourceVersion %s does not match requested %s", obj.GetResourceVersion(), found.ResourceVersion))
 	}
 
-	return s.save(ctx, gvk, obj, found.Path, generation)
+	if found.Object.GetDeletionTimestamp() != nil {
+		if err := checkDeleting(gvk, found, obj); err != nil {
+			return nil, err
+		}
+		if len(obj.GetFinalizers()) == 0 {
+			return s.remove(ctx, gvk, found)
+		}
+	}
+
+	op := OperationUpdate
+	if !generation {
+		op = OperationStatus
+	}
+
+	return s.save(ctx, gvk, obj, found, found.Path, op)
 }
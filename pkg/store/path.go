@@ -0,0 +1,139 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/manifest"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// PathInfo describes a new object to a PathStrategy
+type PathInfo struct {
+	schema.GroupVersionKind
+
+	// Resource is the plural resource name of the kind
+	Resource    string
+	Namespace   string
+	Name        string
+	Labels      map[string]string
+	Annotations map[string]string
+	// Extension is the extension of the default format including the dot, ".yaml" or ".json"
+	Extension string
+}
+
+// PathStrategy decides which file a new object is written to. The path is relative to the
+// subdirectory of the store and must end in .yaml, .yml or .json which decides the format.
+// If the file exists the object is added to the end of it. Objects that already exist are
+// always written back to the file they were read from.
+type PathStrategy interface {
+	Path(info PathInfo) (string, error)
+}
+
+type PathFunc func(info PathInfo) (string, error)
+
+func (p PathFunc) Path(info PathInfo) (string, error) {
+	return p(info)
+}
+
+// DefaultPathStrategy writes objects to <group>/<version>/<kind>/<namespace>/<name>.yaml,
+// or .json if that is the default format. Cluster scoped objects have no namespace so they
+// are stored directly under the kind.
+var DefaultPathStrategy = PathFunc(func(info PathInfo) (string, error) {
+	return filepath.Join(info.Group, info.Version, info.Kind, info.Namespace, info.Name) + info.Extension, nil
+})
+
+// PathTemplate returns a PathStrategy that renders text as a text/template with a PathInfo,
+// for example "{{.Namespace}}/{{.Resource}}/{{.Name}}.yaml". The lower function is available
+// to lower case values.
+func PathTemplate(text string) (PathStrategy, error) {
+	tmpl, err := template.New("path").
+		Option("missingkey=zero").
+		Funcs(template.FuncMap{
+			"lower": strings.ToLower,
+		}).
+		Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path template %q: %w", text, err)
+	}
+
+	return PathFunc(func(info PathInfo) (string, error) {
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, info); err != nil {
+			return "", fmt.Errorf("failed to render path: %w", err)
+		}
+		return buf.String(), nil
+	}), nil
+}
+
+// pathStrategy returns the strategy for gvk, the strategies for a GroupVersionKind with an
+// empty version apply to all versions
+func (s *Store) pathStrategy(gvk schema.GroupVersionKind) PathStrategy {
+	if strategy, ok := s.pathStrategies[gvk]; ok {
+		return strategy
+	}
+	if strategy, ok := s.pathStrategies[gvk.GroupKind().WithVersion("")]; ok {
+		return strategy
+	}
+	if s.defaultPathStrategy != nil {
+		return s.defaultPathStrategy
+	}
+	return DefaultPathStrategy
+}
+
+// newPath returns the absolute path of the file a new object is written to
+func (s *Store) newPath(gvk schema.GroupVersionKind, namespace, name string, labels, annotations map[string]string) (string, error) {
+	info := PathInfo{
+		GroupVersionKind: gvk,
+		Namespace:        namespace,
+		Name:             name,
+		Labels:           labels,
+		Annotations:      annotations,
+		Extension:        s.defaultFormat.Extension(),
+	}
+	if s.resource != nil {
+		info.Resource = s.resource(gvk)
+	}
+	if info.Resource == "" {
+		plural, _ := meta.UnsafeGuessKindToResource(gvk)
+		info.Resource = plural.Resource
+	}
+
+	path, err := s.pathStrategy(gvk).Path(info)
+	if err != nil {
+		return "", err
+	}
+
+	path = filepath.Clean(filepath.FromSlash(strings.TrimSpace(path)))
+	if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", errors.NewBadRequest(fmt.Sprintf("invalid path %q for %s %s, it must be relative to the repository", path, gvk.Kind, name))
+	}
+	format, ok := manifest.FormatFor(path)
+	if !ok {
+		return "", errors.NewBadRequest(fmt.Sprintf("invalid path %q for %s %s, it must end in .yaml, .yml or .json", path, gvk.Kind, name))
+	}
+
+	if s.ignored(filepath.Join(s.root(), path)) {
+		return "", errors.NewBadRequest(fmt.Sprintf("invalid path %q for %s %s, it is excluded by %s or the store options", path, gvk.Kind, name, IgnoreFile))
+	}
+
+	// the working tree also has the files of writes that are not committed yet
+	file := filepath.Join(s.root(), path)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return file, nil
+	} else if err != nil {
+		return "", err
+	}
+	if err := manifest.CanAppend(format, data); err != nil {
+		return "", errors.NewBadRequest(fmt.Sprintf("invalid path %q for %s %s, the object can not be added to the existing file: %v", path, gvk.Kind, name, err))
+	}
+	return file, nil
+}
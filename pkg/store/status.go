@@ -0,0 +1,134 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	gitbackedv1 "github.com/ibuildthecloud/gitbacked-controller/pkg/apis/gitbacked/v1"
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/git"
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/manifest"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// StatusGroupVersionKind is the kind of the GitRepositoryStatus object served by the store
+var StatusGroupVersionKind = gitbackedv1.SchemeGroupVersion.WithKind("GitRepositoryStatus")
+
+// readOnly rejects writes to the kinds served by the store itself
+func readOnly(gvk schema.GroupVersionKind, verb string) error {
+	if gvk.GroupKind() != StatusGroupVersionKind.GroupKind() {
+		return nil
+	}
+	return errors.NewMethodNotSupported(schema.GroupResource{
+		Group:    gvk.Group,
+		Resource: gvk.Kind,
+	}, verb)
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return git.Redact(err.Error())
+}
+
+// addStatus adds the GitRepositoryStatus object for commit to objects
+func (s *Store) addStatus(objects map[ObjectKey]Object, commit string) {
+	status := gitbackedv1.GitRepositoryStatus{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: gitbackedv1.GitRepositoryStatusName,
+		},
+		Status: gitbackedv1.RepositoryStatus{
+			URL:           git.Redact(s.url),
+			Branch:        s.gitOptions.Branch,
+			Commit:        commit,
+			LastSyncTime:  s.syncTime,
+			LastPullError: errorString(s.pullError),
+			LastPushError: errorString(s.pushError),
+			LastScanError: errorString(s.scanError),
+		},
+	}
+
+	for key, paths := range s.duplicates {
+		duplicate := gitbackedv1.DuplicateObject{
+			Group:     key.Group,
+			Kind:      key.Kind,
+			Namespace: key.Namespace,
+			Name:      key.Name,
+		}
+		for _, path := range paths {
+			duplicate.Paths = append(duplicate.Paths, s.relativePath(path))
+		}
+		status.Status.Duplicates = append(status.Status.Duplicates, duplicate)
+	}
+	sort.Slice(status.Status.Duplicates, func(i, j int) bool {
+		return duplicateLess(status.Status.Duplicates[i], status.Status.Duplicates[j])
+	})
+
+	for path, problems := range s.problems {
+		status.Status.Files = append(status.Status.Files, gitbackedv1.FileStatus{
+			Path:     s.relativePath(path),
+			Problems: problems,
+		})
+	}
+	sort.Slice(status.Status.Files, func(i, j int) bool {
+		return status.Status.Files[i].Path < status.Status.Files[j].Path
+	})
+
+	data, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&status)
+	if err != nil {
+		logrus.Errorf("Failed to convert repository status: %v", err)
+		return
+	}
+	// the sync time changes on every refresh, it is left out of the content so that only real
+	// changes of the status make a new revision
+	compared := runtime.DeepCopyJSON(data)
+	unstructured.RemoveNestedField(compared, "status", "lastSyncTime")
+	content, err := json.Marshal(compared)
+	if err != nil {
+		logrus.Errorf("Failed to marshal repository status: %v", err)
+		return
+	}
+
+	obj := &unstructured.Unstructured{
+		Object: data,
+	}
+	obj.SetGroupVersionKind(StatusGroupVersionKind)
+	key := keyFor(StatusGroupVersionKind, "", status.Name)
+	objects[key] = Object{
+		ObjectKey: key,
+		Version:   StatusGroupVersionKind.Version,
+		UID:       deriveUID(key),
+		Content:   content,
+		Object:    obj,
+		Item:      -1,
+	}
+}
+
+// publishStatus adds a revision with the current repository status if it changed. The
+// objects read from git are unchanged.
+func (s *Store) publishStatus() {
+	if !s.scanned {
+		return
+	}
+	latest := s.latest()
+	objects := make(map[ObjectKey]Object, len(latest.data))
+	for key, obj := range latest.data {
+		objects[key] = obj
+	}
+	s.addStatus(objects, s.currentCommit)
+	s.commit(s.currentCommit, 0, objects)
+}
+
+// documentProblem describes a document of a file that is not a valid object
+func documentProblem(doc manifest.Document, message string) string {
+	if doc.Item >= 0 {
+		return fmt.Sprintf("document %d, item %d: %s", doc.Index, doc.Item, message)
+	}
+	return fmt.Sprintf("document %d: %s", doc.Index, message)
+}
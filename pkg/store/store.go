@@ -3,21 +3,31 @@ package store
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io/fs"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/google/uuid"
 	"github.com/ibuildthecloud/gitbacked-controller/pkg/git"
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/manifest"
+	"github.com/ibuildthecloud/gitbacked-controller/pkg/mapping"
 	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/uuid"
-	"sigs.k8s.io/yaml"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/structured-merge-diff/v4/typed"
 )
 
 type ObjectKey struct {
@@ -33,53 +43,215 @@ type Object struct {
 	Version         string
 	ResourceVersion string
 	UID             types.UID
-	Content         []byte
-	Object          *unstructured.Unstructured
-	Path            string
+	// Generation, CreationTimestamp and ManagedFields are kept in memory when they are not in
+	// git
+	Generation        int64
+	CreationTimestamp metav1.Time
+	ManagedFields     []metav1.ManagedFieldsEntry
+	Content           []byte
+	Object            *unstructured.Unstructured
+	Path              string
+	// Document is the index of the YAML document in the file
+	Document int
+	// Item is the index in the items of a List document, -1 if the document is not a List
+	Item int
 }
 
 type Revision struct {
+	// version is the resourceVersion of the revision
+	version int
+	created time.Time
+	// data and index are only kept for the latest revision
 	data     map[ObjectKey]Object
+	index    *index
 	add      []Object
 	deleted  []Object
 	modified []Object
 }
 
+type Options struct {
+	SubDirectory string
+	Git          git.Options
+	// CommitMessageTemplate is a text/template rendered with a CommitInfo for every write
+	CommitMessageTemplate string
+	// BatchWindow is how long a write waits for other writes to be committed and pushed
+	// with it in a single commit. Zero disables batching.
+	BatchWindow time.Duration
+	// BatchSize is the maximum number of writes in a batch, zero means no limit
+	BatchSize int
+	// PushRetries is how many times a rejected push is retried after rebasing the writes
+	// onto the new remote head
+	PushRetries int
+	// RevisionHistory is the number of revisions kept for watches, zero means no limit
+	RevisionHistory int
+	// RevisionHistoryTTL is how long revisions are kept for watches, zero means forever
+	RevisionHistoryTTL time.Duration
+	// ResourceVersionFile keeps the highest resourceVersion so that it keeps increasing
+	// across restarts, even if there were revisions without a commit
+	ResourceVersionFile string
+	// DefaultFormat is the format of new files, used for PathInfo.Extension. Defaults to YAML.
+	DefaultFormat manifest.Format
+	// PathStrategy decides the file of new objects, defaults to DefaultPathStrategy
+	PathStrategy PathStrategy
+	// PathStrategies overrides PathStrategy per kind, a key with an empty version matches
+	// all versions of the kind
+	PathStrategies map[schema.GroupVersionKind]PathStrategy
+	// Resource returns the plural resource name of a kind for PathInfo, if nil or it
+	// returns "" the name is guessed from the kind
+	Resource func(gvk schema.GroupVersionKind) string
+	// CRDHandler is called with the CustomResourceDefinitions in git when they change
+	CRDHandler func(crds []runtime.Object)
+	// ObjectType returns the type of a kind used to track managedFields. If nil or it returns
+	// false the type is deduced from the content of the objects, so every list is atomic.
+	ObjectType func(gvk schema.GroupVersionKind) (typed.ParseableType, bool)
+	// DuplicatePolicy decides what happens to objects that are in more than one file,
+	// defaults to DuplicateFirstWins
+	DuplicatePolicy DuplicatePolicy
+	// GarbageCollection deletes objects whose owners no longer exist and implements the
+	// foreground and orphan propagation policies
+	GarbageCollection bool
+	// FieldManager manages the fields of writes that do not set a field manager, defaults to
+	// DefaultFieldManager
+	FieldManager string
+	// GitFieldManager manages the fields changed by commits that were not written through the
+	// store, defaults to DefaultGitFieldManager
+	GitFieldManager string
+	// PersistMetadata overrides DefaultPersistMetadata, deciding per metadata field if it is
+	// written to git
+	PersistMetadata map[string]bool
+	// Include limits the files read to the ones matching these gitignore style patterns
+	Include []string
+	// Exclude skips the files matching these gitignore style patterns, in addition to the
+	// patterns in IgnoreFile
+	Exclude []string
+}
+
 type Store struct {
 	contentLock      sync.RWMutex
 	contentBroadcast *sync.Cond
 
-	ctx           context.Context
-	url           string
-	branch        string
-	subDir        string
-	repo          *git.Repo
-	revisions     []Revision
+	ctx            context.Context
+	url            string
+	gitOptions     git.Options
+	subDir         string
+	commitTemplate *template.Template
+	batchWindow    time.Duration
+	batchSize      int
+	batch          *batch
+	pushBackoff    wait.Backoff
+	repo           *git.Repo
+	revisions      []Revision
+	// compacted is the version of the newest revision dropped from revisions
+	compacted          int
+	revisionHistory    int
+	revisionHistoryTTL time.Duration
+	// versionFile is where the version of the latest revision is written, if set
+	versionFile string
+	scanned     bool
+	// files caches the objects parsed from every manifest by path so that only the files
+	// changed by a commit are read again
+	files map[string][]Object
+	// problems are the problems found in the files by path, for the repository status
+	problems          map[string][]string
+	duplicatePolicy   DuplicatePolicy
+	duplicates        map[ObjectKey][]string
+	scanError         error
+	garbageCollection bool
+	// seen is the file every object was last read from, for garbage collection to tell
+	// owners that were deleted from owners that are no longer read
+	seen                map[identity]string
+	defaultFieldManager string
+	gitFieldManager     string
+	// written is the managedFields of the objects written by the commit being read
+	written             map[ObjectKey][]metav1.ManagedFieldsEntry
+	gcTrigger           chan struct{}
+	syncTime            metav1.Time
+	pullError           error
+	pushError           error
+	defaultFormat       manifest.Format
+	defaultPathStrategy PathStrategy
+	pathStrategies      map[schema.GroupVersionKind]PathStrategy
+	resource            func(gvk schema.GroupVersionKind) string
+	crdHandler          func(crds []runtime.Object)
+	objectType          func(gvk schema.GroupVersionKind) (typed.ParseableType, bool)
+	persistMetadata     map[string]bool
+	include             gitignore.Matcher
+	exclude             []gitignore.Pattern
+	// ignore is the matcher of the ignore files in git and Exclude
+	ignore        gitignore.Matcher
 	currentCommit string
 	stopped       bool
 }
 
-func New(url, branch, subDir string) (*Store, error) {
+func New(url string, opts Options) (*Store, error) {
+	commitTemplate, err := parseCommitMessageTemplate(opts.CommitMessageTemplate)
+	if err != nil {
+		return nil, err
+	}
+	version, err := readVersion(opts.ResourceVersionFile)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &Store{
-		url:    url,
-		branch: branch,
-		subDir: subDir,
-		// Add the first two empty revisions to that the revision is always at least 1
-		revisions: []Revision{{}, {}},
+		url:                 url,
+		gitOptions:          opts.Git,
+		subDir:              opts.SubDirectory,
+		commitTemplate:      commitTemplate,
+		batchWindow:         opts.BatchWindow,
+		batchSize:           opts.BatchSize,
+		revisionHistory:     opts.RevisionHistory,
+		revisionHistoryTTL:  opts.RevisionHistoryTTL,
+		versionFile:         opts.ResourceVersionFile,
+		defaultFormat:       opts.DefaultFormat,
+		defaultPathStrategy: opts.PathStrategy,
+		pathStrategies:      opts.PathStrategies,
+		resource:            opts.Resource,
+		crdHandler:          opts.CRDHandler,
+		objectType:          opts.ObjectType,
+		persistMetadata:     persistMetadata(opts.PersistMetadata),
+		exclude:             parsePatterns(opts.Exclude),
+		duplicatePolicy:     opts.DuplicatePolicy,
+		garbageCollection:   opts.GarbageCollection,
+		defaultFieldManager: opts.FieldManager,
+		gitFieldManager:     opts.GitFieldManager,
+		pushBackoff: wait.Backoff{
+			Duration: 100 * time.Millisecond,
+			Factor:   2,
+			Jitter:   0.1,
+			Steps:    opts.PushRetries,
+		},
+		// Start with an empty revision after the last resourceVersion handed out, the first
+		// scan always adds a revision after it
+		revisions: []Revision{{version: version}},
+	}
+	if s.defaultFieldManager == "" {
+		s.defaultFieldManager = DefaultFieldManager
+	}
+	if s.gitFieldManager == "" {
+		s.gitFieldManager = DefaultGitFieldManager
+	}
+	if len(opts.Include) > 0 {
+		s.include = gitignore.NewMatcher(parsePatterns(opts.Include))
 	}
 	s.contentBroadcast = sync.NewCond(&s.contentLock)
 	return s, nil
 }
 
 func (s *Store) Start(ctx context.Context, interval time.Duration) error {
-	repo, err := git.New(ctx, s.url, s.branch)
+	repo, err := git.New(ctx, s.url, s.gitOptions)
 	if err != nil {
 		return err
 	}
 	s.repo = repo
 	s.ctx = ctx
+	s.syncTime = metav1.Now()
 
 	go s.refresh(interval)
+	if s.garbageCollection {
+		s.gcTrigger = make(chan struct{}, 1)
+		go s.collectGarbage(ctx)
+	}
 
 	s.contentLock.Lock()
 	defer s.contentLock.Unlock()
@@ -103,12 +275,21 @@ func (s *Store) refreshAndScan() error {
 	s.contentLock.Lock()
 	defer s.contentLock.Unlock()
 
+	// batched writes must land before pulling
+	if err := s.flush(); err != nil {
+		logrus.Errorf("failed to commit batch: %v", err)
+	}
+
 	commit, err := s.repo.Update(s.ctx)
+	s.pullError = err
 	if err != nil {
+		s.publishStatus()
 		return err
 	}
 
+	s.syncTime = metav1.Now()
 	if s.currentCommit == commit {
+		s.publishStatus()
 		return nil
 	}
 
@@ -116,39 +297,128 @@ func (s *Store) refreshAndScan() error {
 }
 
 func (s *Store) scanAndUpdate() error {
-	commit, files, err := s.scan()
+	commit, err := s.repo.Head(s.ctx)
 	if err != nil {
 		return err
 	}
 
-	return s.add(commit, files)
+	if err := s.scan(commit); err != nil {
+		return err
+	}
+
+	count, err := s.repo.CommitCount(s.ctx)
+	if err != nil {
+		return err
+	}
+
+	objects, duplicates := s.objects()
+	s.duplicates = duplicates
+	s.scanError = s.checkDuplicates(commit)
+	if s.scanError != nil {
+		// keep serving the objects of the last commit that was read
+		s.publishStatus()
+		return s.scanError
+	}
+
+	s.addStatus(objects, commit)
+	s.commit(commit, count, objects)
+	return nil
+}
+
+// uidNamespace is used to derive the UID of objects from their identity
+var uidNamespace = uuid.MustParse("8f4ab2b1-3f5e-4d4b-9a52-2f5b7c1e6a10")
+
+// deriveUID returns a UID for objects that do not have one in git, such as files written by
+// hand. It only depends on the identity of the object so it is the same every time the
+// controller starts, and for an object that is deleted and added again.
+func deriveUID(key ObjectKey) types.UID {
+	return types.UID(uuid.NewSHA1(uidNamespace, []byte(strings.Join([]string{
+		key.Group, key.Kind, key.Namespace, key.Name,
+	}, "/"))).String())
 }
 
-func (s *Store) commit(commit string, files map[ObjectKey]Object) {
+// readVersion returns the resourceVersion in path, 0 if path is empty or does not exist
+func readVersion(path string) (int, error) {
+	if path == "" {
+		return 0, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid resourceVersion in %s: %w", path, err)
+	}
+	return version, nil
+}
+
+// writeVersion keeps version in the resourceVersion file, replacing it at once so that a
+// crash doesn't leave a partial file behind
+func (s *Store) writeVersion(version int) {
+	if s.versionFile == "" {
+		return
+	}
+	tmp := s.versionFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(strconv.Itoa(version)+"\n"), 0644); err != nil {
+		logrus.Errorf("Failed to write resourceVersion to %s: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, s.versionFile); err != nil {
+		logrus.Errorf("Failed to write resourceVersion to %s: %v", s.versionFile, err)
+	}
+}
+
+// nextVersion returns the resourceVersion for a new revision. It is derived from the number
+// of commits in the branch so that resourceVersions keep increasing across restarts, and
+// never lower than the last one in the resourceVersion file.
+func (s *Store) nextVersion(commitCount int) int {
+	version := s.latest().version + 1
+	if commitCount > version {
+		return commitCount
+	}
+	return version
+}
+
+func (s *Store) commit(commit string, commitCount int, files map[ObjectKey]Object) {
 	defer s.contentBroadcast.Broadcast()
 
 	var (
-		rev         = strconv.Itoa(len(s.revisions))
+		version     = s.nextVersion(commitCount)
+		rev         = strconv.Itoa(version)
 		newRevision = Revision{
-			data: map[ObjectKey]Object{},
+			version: version,
+			data:    map[ObjectKey]Object{},
 		}
-		currentRev = s.revisions[len(s.revisions)-1]
+		currentRev = s.latest()
+		now        = metav1.Now()
 	)
 
 	for key, obj := range files {
 		existingObject, ok := currentRev.data[key]
 		if ok {
-			if bytes.Equal(existingObject.Content, obj.Content) {
+			if bytes.Equal(existingObject.Content, obj.Content) && existingObject.Path == obj.Path {
+				// other documents in the file may have moved it
+				existingObject.Document = obj.Document
+				existingObject.Item = obj.Item
+				if obj.Path == "" {
+					// synthetic objects have fields that are left out of the content
+					existingObject.Object = obj.Object
+				}
 				newRevision.data[key] = existingObject
 			} else {
 				obj.ResourceVersion = rev
-				obj.UID = existingObject.UID
+				hydrate(&obj, &existingObject, now)
+				s.trackManagedFields(&obj, &existingObject, now)
 				newRevision.modified = append(newRevision.modified, obj)
 				newRevision.data[key] = obj
 			}
 		} else {
-			obj.UID = uuid.NewUUID()
 			obj.ResourceVersion = rev
+			hydrate(&obj, nil, now)
+			s.trackManagedFields(&obj, nil, now)
 			newRevision.add = append(newRevision.add, obj)
 			newRevision.data[key] = obj
 		}
@@ -170,95 +440,217 @@ func (s *Store) commit(commit string, files map[ObjectKey]Object) {
 		})
 		obj.Object.SetResourceVersion(obj.ResourceVersion)
 		obj.Object.SetUID(obj.UID)
+		obj.Object.SetGeneration(obj.Generation)
+		obj.Object.SetCreationTimestamp(obj.CreationTimestamp)
+		obj.Object.SetManagedFields(obj.ManagedFields)
 	}
 
-	if len(newRevision.add) == 0 &&
+	if s.scanned &&
+		len(newRevision.add) == 0 &&
 		len(newRevision.deleted) == 0 &&
 		len(newRevision.modified) == 0 {
+		for key, obj := range newRevision.data {
+			if obj.Path == "" {
+				currentRev.data[key] = obj
+			}
+		}
 		s.currentCommit = commit
 		return
 	}
 
-	s.revisions = append(s.revisions, newRevision)
+	newCommit := s.currentCommit != commit
+	newRevision.index = newIndex(newRevision.data)
+	s.trackOwners(newRevision.data)
+	s.appendRevision(newRevision)
 	s.currentCommit = commit
+	if !s.scanned || crdsChanged(newRevision) {
+		s.notifyCRDs(newRevision)
+	}
+	s.scanned = true
+	s.triggerGC()
+	if !newCommit {
+		// only the repository status changed
+		return
+	}
 	logrus.Infof("Commit: %s", commit)
 	for _, obj := range newRevision.add {
-		logrus.Infof("-> Added: %s", obj.Path)
+		if obj.Path != "" {
+			logrus.Infof("-> Added: %s", obj.Path)
+		}
 	}
 	for _, obj := range newRevision.modified {
-		logrus.Infof("-> Modified: %s", obj.Path)
+		if obj.Path != "" {
+			logrus.Infof("-> Modified: %s", obj.Path)
+		}
 	}
 	for _, obj := range newRevision.deleted {
-		logrus.Infof("-> Deleted: %s", obj.Path)
+		if obj.Path != "" {
+			logrus.Infof("-> Deleted: %s", obj.Path)
+		}
 	}
 }
 
-func (s *Store) add(commit string, files []string) error {
-	newFiles := map[ObjectKey]Object{}
+// appendRevision makes rev the latest revision, only the latest revision keeps the objects
+func (s *Store) appendRevision(rev Revision) {
+	if !s.scanned {
+		// resourceVersions before the first revision are from another run of the store,
+		// watches from them have to relist
+		s.compacted = rev.version
+	}
+	s.writeVersion(rev.version)
+	rev.created = time.Now()
+	s.revisions[len(s.revisions)-1].data = nil
+	s.revisions[len(s.revisions)-1].index = nil
+	s.revisions = append(s.revisions, rev)
+	s.compact()
+}
 
-	for _, file := range files {
-		bytes, err := ioutil.ReadFile(file)
-		if err != nil {
-			logrus.Errorf("Failed to read %s, skipping: %v", file, err)
-			continue
-		}
-		data := map[string]interface{}{}
-		if err := yaml.Unmarshal(bytes, &data); err != nil {
-			logrus.Errorf("Failed to unmarshal %s, skipping: %v", file, err)
-			continue
+func crdsChanged(rev Revision) bool {
+	for _, objs := range [][]Object{rev.add, rev.modified, rev.deleted} {
+		for _, obj := range objs {
+			if obj.Group == mapping.CRDGroupVersionKind.Group && obj.Kind == mapping.CRDGroupVersionKind.Kind {
+				return true
+			}
 		}
+	}
+	return false
+}
 
-		unstr := &unstructured.Unstructured{
-			Object: data,
+func (s *Store) notifyCRDs(rev Revision) {
+	if s.crdHandler == nil {
+		return
+	}
+
+	var crds []runtime.Object
+	for _, keys := range rev.index.candidates(mapping.CRDGroupVersionKind.GroupKind(), "", nil) {
+		for key := range keys {
+			crds = append(crds, rev.data[key].Object)
 		}
-		gvk := unstr.GroupVersionKind()
-
-		obj := Object{
-			ObjectKey: ObjectKey{
-				Kind:      gvk.Kind,
-				Group:     gvk.Group,
-				Name:      unstr.GetName(),
-				Namespace: unstr.GetNamespace(),
-			},
-			Version: gvk.Version,
-			Content: bytes,
-			Object:  unstr,
-			Path:    file,
+	}
+	s.crdHandler(crds)
+}
+
+func (s *Store) latest() Revision {
+	return s.revisions[len(s.revisions)-1]
+}
+
+// compact drops the revisions that are older than the configured history. Watches that
+// start before the remaining revisions fail with 410 Gone.
+func (s *Store) compact() {
+	drop := 0
+	if s.revisionHistory > 0 && len(s.revisions) > s.revisionHistory {
+		drop = len(s.revisions) - s.revisionHistory
+	}
+	if s.revisionHistoryTTL > 0 {
+		cutoff := time.Now().Add(-s.revisionHistoryTTL)
+		for drop < len(s.revisions)-1 && s.revisions[drop].created.Before(cutoff) {
+			drop++
 		}
-		if obj.Kind == "" ||
-			obj.Name == "" ||
-			obj.Version == "" {
-			continue
+	}
+	if drop == 0 {
+		return
+	}
+
+	s.compacted = s.revisions[drop-1].version
+	s.revisions = append([]Revision(nil), s.revisions[drop:]...)
+}
+
+// objects returns the objects of all files and the paths of the objects that are in more than
+// one file or document. The first copy by path is returned, unless the duplicate policy
+// rejects them.
+func (s *Store) objects() (map[ObjectKey]Object, map[ObjectKey][]string) {
+	paths := make([]string, 0, len(s.files))
+	for path := range s.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var (
+		result     = make(map[ObjectKey]Object, len(paths))
+		duplicates = map[ObjectKey][]string{}
+	)
+	for _, path := range paths {
+		for _, obj := range s.files[path] {
+			if first, ok := result[obj.ObjectKey]; ok {
+				if len(duplicates[obj.ObjectKey]) == 0 {
+					duplicates[obj.ObjectKey] = []string{first.Path}
+				}
+				duplicates[obj.ObjectKey] = append(duplicates[obj.ObjectKey], path)
+				continue
+			}
+			result[obj.ObjectKey] = obj
 		}
-		newFiles[obj.ObjectKey] = obj
 	}
 
-	s.commit(commit, newFiles)
-	return nil
+	if s.duplicatePolicy == DuplicateReject {
+		for key := range duplicates {
+			delete(result, key)
+		}
+	}
+	return result, duplicates
 }
 
-func (s *Store) scan() (string, []string, error) {
-	commit, err := s.repo.Head(s.ctx)
-	if err != nil {
-		return "", nil, err
+// scan updates the file cache for commit. Only the files changed since the last scanned
+// commit are read, unless this is the first scan, an ignore file changed or the diff fails,
+// for example because the history was rewritten.
+func (s *Store) scan(commit string) error {
+	if s.files != nil && s.currentCommit != "" {
+		paths, err := s.repo.Diff(s.ctx, s.currentCommit, commit)
+		if err == nil && !ignoreChanged(paths) {
+			s.readFiles(paths)
+			return nil
+		} else if err != nil {
+			logrus.Warnf("Failed to diff %s..%s, rescanning all files: %v", s.currentCommit, commit, err)
+		}
 	}
 
 	var paths []string
-	err = filepath.WalkDir(filepath.Join(s.repo.Dir, s.subDir), func(path string, d fs.DirEntry, err error) error {
+	err := filepath.WalkDir(s.root(), func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 		if d.IsDir() {
 			return nil
 		}
-		pathLower := strings.ToLower(path)
-		if strings.HasSuffix(pathLower, ".yaml") || strings.HasSuffix(pathLower, ".yml") {
-			paths = append(paths, path)
-		}
+		paths = append(paths, path)
 		return nil
 	})
+	if err != nil {
+		return err
+	}
 
-	return commit, paths, err
+	s.loadIgnore(paths)
+	s.files = map[string][]Object{}
+	s.problems = map[string][]string{}
+	s.readFiles(paths)
+	return nil
+}
+
+func (s *Store) root() string {
+	return filepath.Join(s.repo.Dir, s.subDir)
+}
+
+// readFiles reads paths again, dropping the ones that no longer exist
+func (s *Store) readFiles(paths []string) {
+	root := s.root() + string(filepath.Separator)
+	for _, path := range paths {
+		if _, ok := manifest.FormatFor(path); !ok || !strings.HasPrefix(path, root) {
+			continue
+		}
+		delete(s.files, path)
+		delete(s.problems, path)
+		if s.ignored(path) {
+			logrus.Debugf("Ignoring %s", path)
+			continue
+		}
+		objs, problems := s.read(path)
+		if len(objs) > 0 {
+			s.files[path] = objs
+		}
+		if len(problems) > 0 {
+			s.problems[path] = problems
+		}
+	}
 }
 
 func (s *Store) Close() error {
@@ -270,5 +662,8 @@ func (s *Store) Close() error {
 	if s.repo == nil {
 		return nil
 	}
+	if err := s.flush(); err != nil {
+		logrus.Errorf("failed to commit batch on close: %v", err)
+	}
 	return s.repo.Close()
 }
@@ -0,0 +1,43 @@
+package store
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestResourceVersionFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resourceversion")
+	if err := ioutil.WriteFile(path, []byte("41\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New("url", Options{ResourceVersionFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fewer commits than resourceVersions handed out before the restart
+	version := s.nextVersion(3)
+	if version != 42 {
+		t.Errorf("got version %d, expected 42", version)
+	}
+
+	s.appendRevision(Revision{version: version})
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "42\n" {
+		t.Errorf("got %q in the resourceVersion file, expected 42", data)
+	}
+	if s.compacted != 42 {
+		t.Errorf("expected resourceVersions before the first revision to be expired, compacted is %d", s.compacted)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New("url", Options{ResourceVersionFile: path}); err == nil {
+		t.Error("expected an error for an invalid resourceVersion file")
+	}
+}
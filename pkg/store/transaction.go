@@ -0,0 +1,179 @@
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type txOp struct {
+	op            Operation
+	gvk           schema.GroupVersionKind
+	object        client.Object
+	namespace     string
+	name          string
+	preconditions *metav1.Preconditions
+}
+
+// Transaction stages creates, updates and deletes that are committed and pushed as a single
+// git commit. Either all of the writes land or none of them do.
+type Transaction struct {
+	store *Store
+	ops   []txOp
+}
+
+func (s *Store) Begin() *Transaction {
+	return &Transaction{
+		store: s,
+	}
+}
+
+func (t *Transaction) Create(gvk schema.GroupVersionKind, obj client.Object) {
+	t.ops = append(t.ops, txOp{
+		op:     OperationCreate,
+		gvk:    gvk,
+		object: obj,
+	})
+}
+
+func (t *Transaction) Update(gvk schema.GroupVersionKind, obj client.Object) {
+	t.ops = append(t.ops, txOp{
+		op:     OperationUpdate,
+		gvk:    gvk,
+		object: obj,
+	})
+}
+
+// UpdateStatus writes obj without incrementing the generation
+func (t *Transaction) UpdateStatus(gvk schema.GroupVersionKind, obj client.Object) {
+	t.ops = append(t.ops, txOp{
+		op:     OperationStatus,
+		gvk:    gvk,
+		object: obj,
+	})
+}
+
+func (t *Transaction) Delete(gvk schema.GroupVersionKind, namespace, name string, preconditions *metav1.Preconditions) {
+	t.ops = append(t.ops, txOp{
+		op:            OperationDelete,
+		gvk:           gvk,
+		namespace:     namespace,
+		name:          name,
+		preconditions: preconditions,
+	})
+}
+
+func (t *Transaction) validate() error {
+	seen := map[ObjectKey]bool{}
+	for _, op := range t.ops {
+		key := keyFor(op.gvk, op.namespace, op.name)
+		if op.object != nil {
+			if op.object.GetName() == "" {
+				// generated names can not collide
+				continue
+			}
+			key = keyFor(op.gvk, op.object.GetNamespace(), op.object.GetName())
+		}
+		if seen[key] {
+			return errors.NewBadRequest(fmt.Sprintf("%s %s/%s is written more than once in the transaction",
+				key.Kind, key.Namespace, key.Name))
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// Commit checks the preconditions of every write and then commits and pushes them as one
+// commit. The result has an entry for every staged write in the order they were staged,
+// nil for deletes.
+func (t *Transaction) Commit(ctx context.Context) ([]runtime.Object, error) {
+	if len(t.ops) == 0 {
+		return nil, nil
+	}
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+
+	s := t.store
+	s.contentLock.Lock()
+	writes, err := t.stage(ctx)
+	s.contentLock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]runtime.Object, 0, len(writes))
+	for _, w := range writes {
+		obj, err := s.wait(w)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
+
+func (t *Transaction) stage(ctx context.Context) ([]*pendingWrite, error) {
+	s := t.store
+
+	// writes of a transaction are never mixed with other writes
+	if err := s.flush(); err != nil {
+		logrus.Errorf("failed to commit batch: %v", err)
+	}
+	s.batch = &batch{
+		keys:        map[ObjectKey]bool{},
+		held:        true,
+		transaction: true,
+	}
+
+	writes, err := t.stageAll(ctx)
+	if err != nil {
+		s.batch = nil
+		if resetErr := s.repo.Reset(s.ctx); resetErr != nil {
+			logrus.Errorf("failed to reset repo after failed transaction: %v", resetErr)
+		}
+		return nil, err
+	}
+
+	return writes, s.flush()
+}
+
+func (t *Transaction) stageAll(ctx context.Context) ([]*pendingWrite, error) {
+	s := t.store
+	writes := make([]*pendingWrite, 0, len(t.ops))
+
+	for _, op := range t.ops {
+		var (
+			w   *pendingWrite
+			err error
+		)
+		switch op.op {
+		case OperationCreate:
+			w, err = s.create(ctx, op.gvk, op.object)
+		case OperationUpdate:
+			w, err = s.update(ctx, op.gvk, op.object, true)
+		case OperationStatus:
+			w, err = s.update(ctx, op.gvk, op.object, false)
+		case OperationDelete:
+			w, err = s.delete(ctx, op.gvk, op.namespace, op.name, op.preconditions, nil)
+			if err == nil && w == nil {
+				err = errors.NewNotFound(schema.GroupResource{
+					Group:    op.gvk.Group,
+					Resource: op.gvk.Kind,
+				}, op.name)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		writes = append(writes, w)
+	}
+
+	return writes, nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 
 	"github.com/sirupsen/logrus"
@@ -28,23 +29,59 @@ func (w *watcher) ResultChan() <-chan watch.Event {
 	return w.c
 }
 
-func (s *Store) getRevision(opts metav1.ListOptions) (int, error) {
-	if opts.ResourceVersion == "" {
-		return 0, nil
+// getRevision returns the resourceVersion after which a watch starts. Like the apiserver, an
+// empty resourceVersion or "0" starts at the latest revision and the current objects of gk
+// are returned to be sent as added first. A resourceVersion that is too old or newer than the
+// latest one is expired.
+func (s *Store) getRevision(gk schema.GroupKind, opts metav1.ListOptions) (int, []Object, error) {
+	s.contentLock.RLock()
+	defer s.contentLock.RUnlock()
+
+	if opts.ResourceVersion == "" || opts.ResourceVersion == "0" {
+		return s.latest().version, s.current(gk), nil
 	}
-	ret, err := strconv.Atoi(opts.ResourceVersion)
+	version, err := strconv.Atoi(opts.ResourceVersion)
 	if err != nil {
-		return 0, err
+		return 0, nil, errors.NewBadRequest(fmt.Sprintf("invalid resourceVersion %s", opts.ResourceVersion))
+	}
+
+	if latest := s.latest().version; version > latest {
+		// a resourceVersion from before a restart or a rewrite of the branch, relisting gets
+		// the current one
+		return 0, nil, errors.NewResourceExpired(fmt.Sprintf("resource version %d is newer than the latest %d", version, latest))
+	}
+	if version < s.compacted {
+		return 0, nil, expired(version, s.compacted)
+	}
+	return version, nil, nil
+}
+
+// current returns the objects of gk in the latest revision
+func (s *Store) current(gk schema.GroupKind) []Object {
+	var (
+		result []Object
+		rev    = s.latest()
+	)
+	if rev.index == nil {
+		return nil
 	}
-	if ret >= len(s.revisions) {
-		return 0, errors.NewBadRequest(fmt.Sprintf("invalid resourceVersion %s", opts.ResourceVersion))
+	for _, keys := range rev.index.candidates(gk, "", nil) {
+		for key := range keys {
+			result = append(result, rev.data[key])
+		}
 	}
-	// start just after requested version
-	return ret + 1, nil
+	sort.Slice(result, func(i, j int) bool {
+		return keyLess(result[i].ObjectKey, result[j].ObjectKey)
+	})
+	return result
+}
+
+func expired(version, compacted int) error {
+	return errors.NewResourceExpired(fmt.Sprintf("too old resource version: %d (%d)", version, compacted))
 }
 
 func (s *Store) Watch(gvk schema.GroupVersionKind, emptyObj client.Object, opts metav1.ListOptions) (watch.Interface, error) {
-	rev, err := s.getRevision(opts)
+	version, initial, err := s.getRevision(gvk.GroupKind(), opts)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +94,7 @@ func (s *Store) Watch(gvk schema.GroupVersionKind, emptyObj client.Object, opts
 	ctx, cancel := context.WithCancel(context.Background())
 	c := make(chan watch.Event)
 
-	go s.watch(ctx, gvk, emptyObj, c, rev, selector)
+	go s.watch(ctx, gvk, emptyObj, c, version, initial, selector)
 	return &watcher{
 		cancel: cancel,
 		c:      c,
@@ -77,32 +114,55 @@ func (s *Store) isDone(ctx context.Context) bool {
 	return stopped
 }
 
-func (s *Store) watch(ctx context.Context, gvk schema.GroupVersionKind, emptyObj client.Object, c chan watch.Event, rev int, selector labels.Selector) {
+func (s *Store) watch(ctx context.Context, gvk schema.GroupVersionKind, emptyObj client.Object, c chan watch.Event, version int, initial []Object, selector labels.Selector) {
 	defer close(c)
 
+	sendAll(gvk, watch.Added, c, emptyObj, selector, initial)
+
 	for {
 		if s.isDone(ctx) {
 			return
 		}
-		rev = s.readEvents(c, gvk, emptyObj, rev, selector)
+
+		revisions, err := s.revisionsAfter(version)
+		if err != nil {
+			status := err.(errors.APIStatus).Status()
+			c <- watch.Event{
+				Type:   watch.Error,
+				Object: &status,
+			}
+			return
+		}
+
+		for _, revision := range revisions {
+			sendAll(gvk, watch.Added, c, emptyObj, selector, revision.add)
+			sendAll(gvk, watch.Modified, c, emptyObj, selector, revision.modified)
+			sendAll(gvk, watch.Deleted, c, emptyObj, selector, revision.deleted)
+			version = revision.version
+		}
 
 		s.contentBroadcast.L.Lock()
-		if rev >= len(s.revisions) {
+		if version >= s.latest().version && !s.stopped {
 			s.contentBroadcast.Wait()
 		}
 		s.contentBroadcast.L.Unlock()
 	}
 }
 
-func (s *Store) readEvents(c chan<- watch.Event, gvk schema.GroupVersionKind, emptyObject client.Object, rev int, selector labels.Selector) int {
-	for ; rev < len(s.revisions); rev++ {
-		revision := s.revisions[rev]
-		sendAll(gvk, watch.Added, c, emptyObject, selector, revision.add)
-		sendAll(gvk, watch.Modified, c, emptyObject, selector, revision.modified)
-		sendAll(gvk, watch.Deleted, c, emptyObject, selector, revision.deleted)
+// revisionsAfter returns the revisions newer than version, failing if some of them were
+// already compacted
+func (s *Store) revisionsAfter(version int) ([]Revision, error) {
+	s.contentLock.RLock()
+	defer s.contentLock.RUnlock()
+
+	if version < s.compacted {
+		return nil, expired(version, s.compacted)
 	}
 
-	return rev
+	i := sort.Search(len(s.revisions), func(i int) bool {
+		return s.revisions[i].version > version
+	})
+	return s.revisions[i:], nil
 }
 
 func sendAll(gvk schema.GroupVersionKind, event watch.EventType, c chan<- watch.Event, emptyObject client.Object, selector labels.Selector, objs []Object) {
@@ -132,6 +192,10 @@ func sendAll(gvk schema.GroupVersionKind, event watch.EventType, c chan<- watch.
 }
 
 func Convert(to, from interface{}) error {
+	if from == nil {
+		// the object was removed by the write
+		return nil
+	}
 	data, err := json.Marshal(from)
 	if err != nil {
 		return err
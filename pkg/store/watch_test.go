@@ -0,0 +1,55 @@
+package store
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestGetRevision(t *testing.T) {
+	s := &Store{
+		compacted: 4,
+		revisions: []Revision{
+			{version: 5},
+			{version: 6, data: map[ObjectKey]Object{}, index: newIndex(nil)},
+		},
+	}
+	gk := schema.GroupKind{Kind: "ConfigMap"}
+
+	tests := []struct {
+		resourceVersion string
+		version         int
+		expired         bool
+		badRequest      bool
+	}{
+		{resourceVersion: "", version: 6},
+		{resourceVersion: "0", version: 6},
+		{resourceVersion: "5", version: 5},
+		{resourceVersion: "6", version: 6},
+		{resourceVersion: "3", expired: true},
+		{resourceVersion: "7", expired: true},
+		{resourceVersion: "x", badRequest: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.resourceVersion, func(t *testing.T) {
+			version, _, err := s.getRevision(gk, metav1.ListOptions{ResourceVersion: tt.resourceVersion})
+			switch {
+			case tt.expired:
+				if !errors.IsResourceExpired(err) {
+					t.Errorf("expected an expired error, got %v", err)
+				}
+			case tt.badRequest:
+				if !errors.IsBadRequest(err) {
+					t.Errorf("expected a bad request, got %v", err)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case version != tt.version:
+				t.Errorf("got version %d, expected %d", version, tt.version)
+			}
+		})
+	}
+}